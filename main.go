@@ -9,19 +9,26 @@ import (
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
 )
 
 func main() {
 	// Parse command line flags
-	configPath := flag.String("config", "config.yaml", "Path to configuration file")
+	configPath := flag.String("config", "config.yaml", "Path to configuration file, directory or glob pattern")
 	listenAddr := flag.String("listen", ":8080", "Address to listen on")
+	watchInterval := flag.Duration("watch", 5*time.Second, "How often to check the configuration file for changes (0 disables)")
 	flag.Parse()
 
+	// Keep secrets from the configuration out of the logs
+	logOutput := config.NewRedactingWriter(os.Stderr)
+	log.SetOutput(logOutput)
+
 	// Load configuration
 	cfg, err := config.LoadConfig(*configPath)
 	if err != nil {
 		log.Fatalf("Failed to load configuration: %v", err)
 	}
+	logOutput.SetSecrets(cfg.Secrets)
 
 	// Validate configuration
 	if err := config.ValidateConfig(cfg); err != nil {
@@ -38,10 +45,49 @@ func main() {
 
 	fmt.Printf("Server started on %s\n", *listenAddr)
 
-	// Wait for interrupt signal
+	// Reload the configuration when the file changes
+	changed := make(chan struct{}, 1)
+	watcher := config.NewWatcher(cfg.Paths, *watchInterval)
+	watcher.Start(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	defer watcher.Stop()
+
+	reload := func(reason string) {
+		log.Printf("Reloading configuration from %s (%s)", *configPath, reason)
+		cfg, err := config.LoadConfig(*configPath)
+		if err == nil {
+			// Secrets of both configurations may still show up in logs
+			logOutput.SetSecrets(append(server.Config().Secrets, cfg.Secrets...))
+			err = server.Reload(cfg)
+		}
+		if err != nil {
+			log.Printf("Failed to reload configuration, keeping the current one: %v", err)
+			return
+		}
+		// Included files may have changed
+		watcher.SetPaths(cfg.Paths)
+		logOutput.SetSecrets(cfg.Secrets)
+	}
+
+	// Wait for interrupt signal, reloading on SIGHUP
 	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP)
+wait:
+	for {
+		select {
+		case sig := <-sigChan:
+			if sig != syscall.SIGHUP {
+				break wait
+			}
+			reload("SIGHUP")
+		case <-changed:
+			reload("file changed")
+		}
+	}
 
 	fmt.Println("\nShutting down server...")
 	if err := server.Stop(); err != nil {
@@ -1,16 +1,20 @@
 package api
 
 import (
+	"errors"
 	"fmt"
+	"log"
 	"mk-addrlist-generator/pkg/config"
 	"mk-addrlist-generator/pkg/generator"
 	"net/http"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 )
 
 type Server struct {
-	cfg       *config.Config
 	generator *generator.Generator
 	router    *gin.Engine
 	server    *http.Server
@@ -18,7 +22,6 @@ type Server struct {
 
 func NewServer(cfg *config.Config) *Server {
 	s := &Server{
-		cfg:       cfg,
 		generator: generator.NewGenerator(cfg),
 		router:    gin.Default(),
 	}
@@ -31,6 +34,8 @@ func NewServer(cfg *config.Config) *Server {
 }
 
 func (s *Server) Start(addr string) error {
+	s.generator.Start()
+
 	s.server = &http.Server{
 		Addr:    addr,
 		Handler: s.router,
@@ -39,37 +44,94 @@ func (s *Server) Start(addr string) error {
 }
 
 func (s *Server) Stop() error {
+	s.generator.Stop()
+
 	if s.server != nil {
 		return s.server.Close()
 	}
 	return nil
 }
 
+// Config returns the configuration currently in effect. The generator
+// holds it, so that lists are always looked up and generated with the
+// same configuration.
+func (s *Server) Config() *config.Config {
+	return s.generator.Config()
+}
+
+// Reload validates cfg and switches the server and its generator to it,
+// logging which lists were added, removed or changed. If cfg is invalid
+// the current configuration stays in effect.
+func (s *Server) Reload(cfg *config.Config) error {
+	if err := config.ValidateConfig(cfg); err != nil {
+		return fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	changes := config.Diff(s.generator.Config(), cfg)
+	s.generator.Reload(cfg)
+
+	if changes.Empty() {
+		log.Printf("Configuration reloaded, no changes")
+		return nil
+	}
+	log.Printf("Configuration reloaded: lists added %v, removed %v, changed %v, global settings changed: %t",
+		changes.Added, changes.Removed, changes.Changed, changes.Defaults)
+	return nil
+}
+
 func (s *Server) HandleGetAllLists(c *gin.Context) {
-	script, err := s.generator.GenerateAll()
+	report, err := s.generator.GenerateAllReport(generatorOptions(c))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.Config().Redact(err.Error())})
 		return
 	}
 
+	setReportHeaders(c, report)
 	c.Header("Content-Type", "text/plain")
-	c.String(http.StatusOK, script)
+	c.String(http.StatusOK, report.Script)
 }
 
 func (s *Server) HandleGetListByName(c *gin.Context) {
 	name := c.Param("name")
-	list, exists := s.cfg.Lists[name]
-	if !exists {
+	report, err := s.generator.GenerateNamedListReport(name, generatorOptions(c))
+	if errors.Is(err, generator.ErrUnknownList) {
 		c.JSON(http.StatusNotFound, gin.H{"error": fmt.Sprintf("list %s not found", name)})
 		return
 	}
-
-	script, err := s.generator.GenerateList(name, list)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": s.Config().Redact(err.Error())})
 		return
 	}
 
+	setReportHeaders(c, report)
 	c.Header("Content-Type", "text/plain")
-	c.String(http.StatusOK, script)
+	c.String(http.StatusOK, report.Script)
+}
+
+// generatorOptions builds generation options from the query string. Each
+// "since" parameter is a list version the router currently has.
+func generatorOptions(c *gin.Context) generator.Options {
+	return generator.Options{
+		Since: c.QueryArray("since"),
+	}
+}
+
+// setReportHeaders reports sources that failed but were skipped or served
+// stale, so monitoring can alert on degraded lists, the number of entries
+// exclusions removed, and the version of every generated list.
+func setReportHeaders(c *gin.Context, report generator.Report) {
+	c.Header("X-Source-Errors", strconv.Itoa(len(report.SourceErrors)))
+	for _, e := range report.SourceErrors {
+		c.Writer.Header().Add("X-Source-Error", strings.Join(strings.Fields(e.Error()), " "))
+	}
+	c.Header("X-Excluded-Entries", strconv.Itoa(len(report.Exclusions)))
+
+	names := make([]string, 0, len(report.Versions))
+	for name := range report.Versions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		c.Writer.Header().Add("X-List-Version", name+"="+report.Versions[name])
+	}
 }
@@ -4,6 +4,7 @@ import (
 	"mk-addrlist-generator/pkg/config"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -15,10 +16,10 @@ func TestServer_HandleGetAllLists(t *testing.T) {
 		},
 		Lists: map[string]config.List{
 			"test": {
-				Addresses: []string{
+				Addresses: []config.AddressGroup{{Addresses: []string{
 					"192.168.1.1",
 					"10.0.0.0/24",
-				},
+				}}},
 			},
 		},
 	}
@@ -41,10 +42,10 @@ func TestServer_HandleGetListByName(t *testing.T) {
 		},
 		Lists: map[string]config.List{
 			"test": {
-				Addresses: []string{
+				Addresses: []config.AddressGroup{{Addresses: []string{
 					"192.168.1.1",
 					"10.0.0.0/24",
-				},
+				}}},
 			},
 		},
 	}
@@ -80,3 +81,121 @@ func TestServer_HandleGetListByName(t *testing.T) {
 		})
 	}
 }
+
+func TestServer_SourceErrorHeaders(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout: "1d",
+			OnError: config.OnErrorSkip,
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Files:     []config.FileSource{{Path: "/nonexistent/list.txt"}},
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+			},
+		},
+	}
+
+	server := NewServer(cfg)
+
+	for _, path := range []string{"/lists/all", "/list/test"} {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", path, nil)
+		server.router.ServeHTTP(w, req)
+
+		if w.Code != http.StatusOK {
+			t.Errorf("GET %s status = %v, want %v", path, w.Code, http.StatusOK)
+		}
+		if got := w.Header().Get("X-Source-Errors"); got != "1" {
+			t.Errorf("GET %s X-Source-Errors = %q, want %q", path, got, "1")
+		}
+		if got := w.Header().Get("X-Source-Error"); got == "" {
+			t.Errorf("GET %s X-Source-Error header missing", path)
+		}
+		if got := w.Header().Get("X-Excluded-Entries"); got != "0" {
+			t.Errorf("GET %s X-Excluded-Entries = %q, want %q", path, got, "0")
+		}
+	}
+}
+
+func TestServer_HandleGetListByNameSince(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout: "1d",
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+			},
+		},
+	}
+
+	server := NewServer(cfg)
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/list/test", nil)
+	server.router.ServeHTTP(w, req)
+
+	version := strings.TrimPrefix(w.Header().Get("X-List-Version"), "test=")
+	if version == "" {
+		t.Fatal("HandleGetListByName() X-List-Version header missing")
+	}
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/list/test?since="+version, nil)
+	server.router.ServeHTTP(w, req)
+
+	if strings.Contains(w.Body.String(), `remove [ find where list="test" ];`) {
+		t.Errorf("HandleGetListByName() with known version returned a full script")
+	}
+}
+
+func TestServer_Reload(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+			},
+		},
+	}
+	server := NewServer(cfg)
+
+	get := func(name string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("GET", "/list/"+name, nil)
+		server.router.ServeHTTP(w, req)
+		return w
+	}
+
+	// An invalid configuration is rejected and the current one kept
+	invalid := &config.Config{Lists: map[string]config.List{"broken": {}}}
+	if err := server.Reload(invalid); err == nil {
+		t.Fatal("Reload() accepted an invalid configuration")
+	}
+	if w := get("test"); w.Code != http.StatusOK {
+		t.Errorf("list test status after failed reload = %v, want %v", w.Code, http.StatusOK)
+	}
+
+	updated := &config.Config{
+		Config: cfg.Config,
+		Lists: map[string]config.List{
+			"other": {
+				Addresses: []config.AddressGroup{{Addresses: []string{"10.0.0.1"}}},
+			},
+		},
+	}
+	if err := server.Reload(updated); err != nil {
+		t.Fatalf("Reload() error = %v", err)
+	}
+	if w := get("test"); w.Code != http.StatusNotFound {
+		t.Errorf("removed list status = %v, want %v", w.Code, http.StatusNotFound)
+	}
+	w := get("other")
+	if w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `$otherAddIP "10.0.0.1"`) {
+		t.Errorf("added list status = %v, body = %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,91 @@
+package config
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// ValidateAddress checks a static or exclude address: an IPv4/IPv6 host,
+// a CIDR prefix or a "<start>-<end>" range of one address family. It
+// accepts the same forms as the generator's address parser.
+func ValidateAddress(s string) error {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return fmt.Errorf("empty address")
+	}
+
+	if start, end, ok := strings.Cut(s, "-"); ok {
+		from, err := validateAddr(start)
+		if err != nil {
+			return err
+		}
+		to, err := validateAddr(end)
+		if err != nil {
+			return err
+		}
+		if from.Is4() != to.Is4() {
+			return fmt.Errorf("invalid range %q: mixed address families", s)
+		}
+		if from.Compare(to) > 0 {
+			return fmt.Errorf("invalid range %q: start is after end", s)
+		}
+		return nil
+	}
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return fmt.Errorf("invalid prefix %q", s)
+		}
+		if prefix.Addr().Zone() != "" {
+			return fmt.Errorf("invalid prefix %q: zones are not supported", s)
+		}
+		return nil
+	}
+
+	_, err := validateAddr(s)
+	return err
+}
+
+func validateAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("invalid address %q: zones are not supported", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// ValidateDomain checks a domain name to be resolved: dot-separated labels
+// of letters, digits, "-" and "_" of at most 63 characters, not starting
+// or ending with "-", with an optional trailing dot.
+func ValidateDomain(s string) error {
+	name := strings.TrimSuffix(s, ".")
+	if name == "" || len(name) > 253 {
+		return fmt.Errorf("invalid domain %q", s)
+	}
+	for _, label := range strings.Split(name, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return fmt.Errorf("invalid domain %q", s)
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+				return fmt.Errorf("invalid domain %q", s)
+			}
+		}
+	}
+	return nil
+}
+
+func validateAddresses(addrs []string) error {
+	for _, addr := range addrs {
+		if err := ValidateAddress(addr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
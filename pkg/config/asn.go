@@ -0,0 +1,38 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ASNData configures the local prefix-to-ASN table used to expand the
+// asns sources of lists.
+type ASNData struct {
+	File    string `yaml:"file"`
+	Refresh string `yaml:"refresh,omitempty"`
+}
+
+// GetRefresh returns how often the ASN data file is reloaded, or zero if
+// it is only loaded once.
+func (a ASNData) GetRefresh() (time.Duration, error) {
+	if a.Refresh == "" {
+		return 0, nil
+	}
+	return ParseDuration(a.Refresh)
+}
+
+// ParseASN parses an AS number written as "13335" or "AS13335".
+func ParseASN(s string) (uint32, error) {
+	s = strings.TrimSpace(s)
+	digits := s
+	if len(s) > 2 && strings.EqualFold(s[:2], "AS") {
+		digits = s[2:]
+	}
+	asn, err := strconv.ParseUint(digits, 10, 32)
+	if err != nil {
+		return 0, fmt.Errorf("invalid AS number: %q", s)
+	}
+	return uint32(asn), nil
+}
@@ -0,0 +1,46 @@
+package config
+
+import (
+	"reflect"
+	"sort"
+)
+
+// Changes describes how a configuration differs from the previous one.
+type Changes struct {
+	Added   []string
+	Removed []string
+	Changed []string
+	// Defaults is set when the global settings under config: changed,
+	// which can affect every list.
+	Defaults bool
+}
+
+// Empty reports whether the configurations are identical.
+func (c Changes) Empty() bool {
+	return len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Changed) == 0 && !c.Defaults
+}
+
+// Diff compares two configurations list by list. List names are sorted.
+func Diff(old, updated *Config) Changes {
+	var changes Changes
+	for name, list := range updated.Lists {
+		previous, ok := old.Lists[name]
+		switch {
+		case !ok:
+			changes.Added = append(changes.Added, name)
+		case !reflect.DeepEqual(previous, list):
+			changes.Changed = append(changes.Changed, name)
+		}
+	}
+	for name := range old.Lists {
+		if _, ok := updated.Lists[name]; !ok {
+			changes.Removed = append(changes.Removed, name)
+		}
+	}
+	changes.Defaults = !reflect.DeepEqual(old.Config, updated.Config)
+
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Changed)
+	return changes
+}
@@ -0,0 +1,43 @@
+package config
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	old := &Config{
+		Config: ConfigDefaults{Timeout: "1d"},
+		Lists: map[string]List{
+			"kept":    {Addresses: []AddressGroup{{Addresses: []string{"192.0.2.1"}}}},
+			"changed": {Addresses: []AddressGroup{{Addresses: []string{"192.0.2.2"}}}},
+			"removed": {Domains: []string{"example.com"}},
+		},
+	}
+	updated := &Config{
+		Config: ConfigDefaults{Timeout: "1d"},
+		Lists: map[string]List{
+			"kept":    {Addresses: []AddressGroup{{Addresses: []string{"192.0.2.1"}}}},
+			"changed": {Addresses: []AddressGroup{{Addresses: []string{"192.0.2.3"}}}},
+			"added":   {Domains: []string{"example.org"}},
+		},
+	}
+
+	got := Diff(old, updated)
+	want := Changes{
+		Added:   []string{"added"},
+		Removed: []string{"removed"},
+		Changed: []string{"changed"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Diff() = %+v, want %+v", got, want)
+	}
+
+	updated.Config.Timeout = "2d"
+	if got := Diff(old, updated); !got.Defaults {
+		t.Errorf("Diff() did not report changed global settings")
+	}
+	if got := Diff(old, old); !got.Empty() {
+		t.Errorf("Diff() of identical configurations = %+v, want no changes", got)
+	}
+}
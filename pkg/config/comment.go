@@ -0,0 +1,51 @@
+package config
+
+import (
+	"fmt"
+	"text/template"
+)
+
+// DefaultCommentTemplate renders entry comments as the comment prefix and
+// source name, followed by the score and comment the source gave the
+// entry, if any.
+const DefaultCommentTemplate = `{{.Prefix}}/{{.SourceName}}{{with .Score}}/score={{.}}{{end}}{{with .Comment}}/{{.}}{{end}}`
+
+// DefaultCommentMaxLength is the length entry comments are truncated to
+// unless commentMaxLength is configured.
+const DefaultCommentMaxLength = 255
+
+// GetCommentTemplate returns the template entry comments of the list are
+// rendered with.
+func (l *List) GetCommentTemplate(defaults ConfigDefaults) string {
+	if l.CommentTemplate != "" {
+		return l.CommentTemplate
+	}
+	if defaults.CommentTemplate != "" {
+		return defaults.CommentTemplate
+	}
+	return DefaultCommentTemplate
+}
+
+// GetCommentMaxLength returns the number of characters entry comments of
+// the list are truncated to.
+func (l *List) GetCommentMaxLength(defaults ConfigDefaults) int {
+	if l.CommentMaxLength > 0 {
+		return l.CommentMaxLength
+	}
+	if defaults.CommentMaxLength > 0 {
+		return defaults.CommentMaxLength
+	}
+	return DefaultCommentMaxLength
+}
+
+func validateComment(tmpl string, maxLength int) error {
+	if tmpl != "" {
+		if _, err := template.New("comment").Parse(tmpl); err != nil {
+			return fmt.Errorf("invalid commentTemplate: %v", err)
+		}
+	}
+	if maxLength < 0 {
+		return fmt.Errorf("invalid commentMaxLength: %d", maxLength)
+	}
+	return nil
+}
@@ -3,24 +3,174 @@ package config
 import (
 	"fmt"
 	"os"
+	"path/filepath"
+	"sort"
+	"strings"
 
 	"gopkg.in/yaml.v3"
 )
 
+// fileConfig is the content of a single configuration file.
+type fileConfig struct {
+	Config  *ConfigDefaults `yaml:"config"`
+	Include []string        `yaml:"include"`
+	Lists   map[string]List `yaml:"lists"`
+}
+
+// LoadConfig loads the configuration from a file, from every .yaml and
+// .yml file in a directory, or from the files matching a glob pattern.
+// Files may pull in further files, directories or patterns with include:,
+// resolved relative to the including file. The lists of all files are
+// merged; a list name may only be defined once, and the global config:
+// section may only appear in one file. ${NAME} and ${file:/path}
+// references are expanded in every value.
 func LoadConfig(path string) (*Config, error) {
-	data, err := os.ReadFile(path)
+	l := &loader{
+		cfg:       &Config{Lists: make(map[string]List)},
+		listFiles: make(map[string]string),
+		loading:   make(map[string]bool),
+		loaded:    make(map[string]bool),
+	}
+
+	files, err := l.expand(path)
 	if err != nil {
 		return nil, err
 	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("no configuration files found in %s", path)
+	}
+	for _, file := range files {
+		if err := l.load(file); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := ValidateConfig(l.cfg); err != nil {
+		return nil, fmt.Errorf("invalid configuration: %v", err)
+	}
+
+	return l.cfg, nil
+}
+
+// loader merges configuration files into a single configuration.
+type loader struct {
+	cfg        *Config
+	configFile string            // file holding the config: section
+	listFiles  map[string]string // list name -> file defining it
+	loading    map[string]bool   // files being loaded, to detect include cycles
+	loaded     map[string]bool
+}
+
+// expand returns the files a path refers to: the path itself, the YAML
+// files of a directory or the matches of a glob pattern, in sorted order.
+// Directories are remembered so that new files in them are noticed.
+func (l *loader) expand(path string) ([]string, error) {
+	if strings.ContainsAny(path, "*?[") {
+		matches, err := filepath.Glob(path)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %s: %v", path, err)
+		}
+		l.cfg.Paths = append(l.cfg.Paths, filepath.Dir(path))
+		sort.Strings(matches)
+		return matches, nil
+	}
 
-	var cfg Config
-	if err := yaml.Unmarshal(data, &cfg); err != nil {
+	info, err := os.Stat(path)
+	if err != nil {
 		return nil, err
 	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
 
-	if err := ValidateConfig(&cfg); err != nil {
-		return nil, fmt.Errorf("invalid configuration: %v", err)
+	entries, err := os.ReadDir(path)
+	if err != nil {
+		return nil, err
+	}
+	l.cfg.Paths = append(l.cfg.Paths, path)
+	var files []string
+	for _, entry := range entries {
+		ext := filepath.Ext(entry.Name())
+		if !entry.IsDir() && (ext == ".yaml" || ext == ".yml") {
+			files = append(files, filepath.Join(path, entry.Name()))
+		}
+	}
+	return files, nil
+}
+
+// load merges a file and the files it includes into the configuration.
+// A file included more than once is only loaded the first time.
+func (l *loader) load(path string) error {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return err
+	}
+	if l.loading[abs] {
+		return fmt.Errorf("%s: include cycle", path)
+	}
+	if l.loaded[abs] {
+		return nil
+	}
+	l.loading[abs] = true
+	defer delete(l.loading, abs)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	secrets, err := interpolate(&doc, path)
+	if err != nil {
+		return err
+	}
+	var fc fileConfig
+	if doc.Kind != 0 {
+		if err := doc.Decode(&fc); err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+	}
+	l.cfg.Paths = append(l.cfg.Paths, path)
+	l.cfg.Secrets = append(l.cfg.Secrets, secrets...)
+
+	if fc.Config != nil {
+		if l.configFile != "" {
+			return fmt.Errorf("config section is defined in both %s and %s", l.configFile, path)
+		}
+		l.configFile = path
+		l.cfg.Config = *fc.Config
+	}
+
+	names := make([]string, 0, len(fc.Lists))
+	for name := range fc.Lists {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if previous, ok := l.listFiles[name]; ok {
+			return fmt.Errorf("list %s is defined in both %s and %s", name, previous, path)
+		}
+		l.listFiles[name] = path
+		l.cfg.Lists[name] = fc.Lists[name]
+	}
+
+	for _, include := range fc.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		files, err := l.expand(include)
+		if err != nil {
+			return fmt.Errorf("%s: include %s: %v", path, include, err)
+		}
+		for _, file := range files {
+			if err := l.load(file); err != nil {
+				return err
+			}
+		}
 	}
 
-	return &cfg, nil
+	l.loaded[abs] = true
+	return nil
 }
@@ -1,6 +1,9 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 )
@@ -16,6 +19,11 @@ func TestLoadConfig(t *testing.T) {
 			path:    "../../config.example.yaml",
 			wantErr: false,
 		},
+		{
+			name:    "docker example config",
+			path:    "../../config/config.example.yaml",
+			wantErr: false,
+		},
 		{
 			name:    "non-existent file",
 			path:    "nonexistent.yaml",
@@ -33,6 +41,75 @@ func TestLoadConfig(t *testing.T) {
 	}
 }
 
+func TestLoadConfig_Fragments(t *testing.T) {
+	write := func(t *testing.T, path, content string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	t.Run("directory with include", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "conf.d", "00-global.yaml"), "config:\n  timeout: 1d\ninclude:\n  - ../teams/*.yml\n")
+		write(t, filepath.Join(dir, "conf.d", "10-static.yaml"), "lists:\n  static:\n    addresses: [192.0.2.1]\n")
+		write(t, filepath.Join(dir, "conf.d", "README.md"), "not configuration")
+		write(t, filepath.Join(dir, "teams", "dns.yml"), "lists:\n  saas:\n    domains: [example.com]\n")
+
+		cfg, err := LoadConfig(filepath.Join(dir, "conf.d"))
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if cfg.Config.Timeout != "1d" {
+			t.Errorf("LoadConfig() timeout = %q, want 1d", cfg.Config.Timeout)
+		}
+		for _, name := range []string{"static", "saas"} {
+			if _, ok := cfg.Lists[name]; !ok {
+				t.Errorf("LoadConfig() is missing list %s", name)
+			}
+		}
+	})
+
+	t.Run("glob", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "a.yaml"), "lists:\n  a:\n    addresses: [192.0.2.1]\n")
+		write(t, filepath.Join(dir, "b.yaml"), "lists:\n  b:\n    addresses: [192.0.2.2]\n")
+
+		cfg, err := LoadConfig(filepath.Join(dir, "*.yaml"))
+		if err != nil {
+			t.Fatalf("LoadConfig() error = %v", err)
+		}
+		if len(cfg.Lists) != 2 {
+			t.Errorf("LoadConfig() lists = %v, want a and b", cfg.Lists)
+		}
+	})
+
+	t.Run("duplicate list", func(t *testing.T) {
+		dir := t.TempDir()
+		first, second := filepath.Join(dir, "a.yaml"), filepath.Join(dir, "b.yaml")
+		write(t, first, "lists:\n  shared:\n    addresses: [192.0.2.1]\n")
+		write(t, second, "lists:\n  shared:\n    addresses: [192.0.2.2]\n")
+
+		_, err := LoadConfig(dir)
+		if err == nil || !strings.Contains(err.Error(), first) || !strings.Contains(err.Error(), second) {
+			t.Errorf("LoadConfig() error = %v, want one naming %s and %s", err, first, second)
+		}
+	})
+
+	t.Run("include cycle", func(t *testing.T) {
+		dir := t.TempDir()
+		write(t, filepath.Join(dir, "a.yaml"), "include: [b.yaml]\nlists:\n  a:\n    addresses: [192.0.2.1]\n")
+		write(t, filepath.Join(dir, "b.yaml"), "include: [a.yaml]\n")
+
+		if _, err := LoadConfig(filepath.Join(dir, "a.yaml")); err == nil {
+			t.Error("LoadConfig() accepted an include cycle")
+		}
+	})
+}
+
 func TestList_GetTimeout(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -86,6 +163,17 @@ func TestList_GetTimeout(t *testing.T) {
 			want:    24 * time.Hour,
 			wantErr: false,
 		},
+		{
+			name: "permanent",
+			list: List{
+				Timeout: "none",
+			},
+			defaults: ConfigDefaults{
+				Timeout: "1d",
+			},
+			want:    0,
+			wantErr: false,
+		},
 		{
 			name:     "default timeout",
 			list:     List{},
@@ -161,6 +249,208 @@ func TestList_GetCommentPrefix(t *testing.T) {
 	}
 }
 
+func TestList_GetRefresh(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     List
+		defaults ConfigDefaults
+		want     time.Duration
+		wantErr  bool
+	}{
+		{
+			name:     "list refresh",
+			list:     List{Refresh: "15m"},
+			defaults: ConfigDefaults{Refresh: "1h"},
+			want:     15 * time.Minute,
+		},
+		{
+			name:     "global refresh",
+			list:     List{},
+			defaults: ConfigDefaults{Refresh: "1h"},
+			want:     time.Hour,
+		},
+		{
+			name:     "no refresh",
+			list:     List{},
+			defaults: ConfigDefaults{},
+			want:     0,
+		},
+		{
+			name:     "invalid refresh",
+			list:     List{Refresh: "invalid"},
+			defaults: ConfigDefaults{},
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list.GetRefresh(tt.defaults)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List.GetRefresh() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if got != tt.want {
+				t.Errorf("List.GetRefresh() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_GetOnError(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     List
+		defaults ConfigDefaults
+		want     string
+	}{
+		{
+			name:     "list policy",
+			list:     List{OnError: OnErrorSkip},
+			defaults: ConfigDefaults{OnError: OnErrorStale},
+			want:     OnErrorSkip,
+		},
+		{
+			name:     "global policy",
+			list:     List{},
+			defaults: ConfigDefaults{OnError: OnErrorStale},
+			want:     OnErrorStale,
+		},
+		{
+			name:     "default policy",
+			list:     List{},
+			defaults: ConfigDefaults{},
+			want:     OnErrorFail,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.list.GetOnError(tt.defaults)
+			if got != tt.want {
+				t.Errorf("List.GetOnError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_GetFamily(t *testing.T) {
+	tests := []struct {
+		name string
+		list List
+		want string
+	}{
+		{
+			name: "default",
+			list: List{},
+			want: FamilyBoth,
+		},
+		{
+			name: "ipv4",
+			list: List{Family: FamilyIPv4},
+			want: FamilyIPv4,
+		},
+		{
+			name: "ipv6",
+			list: List{Family: FamilyIPv6},
+			want: FamilyIPv6,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.list.GetFamily()
+			if got != tt.want {
+				t.Errorf("List.GetFamily() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_UsesListTimeout(t *testing.T) {
+	timed := SourceOptions{Timeout: "1h"}
+	disabled := false
+	tests := []struct {
+		name string
+		list List
+		want bool
+	}{
+		{
+			name: "source without timeout",
+			list: List{URLs: []URLSource{{URL: "https://example.com", SourceOptions: timed}, {URL: "https://example.org"}}},
+			want: true,
+		},
+		{
+			name: "all sources with timeout",
+			list: List{
+				URLs:      []URLSource{{URL: "https://example.com", SourceOptions: timed}},
+				Files:     []FileSource{{Path: "list.txt", SourceOptions: timed}},
+				Addresses: []AddressGroup{{Addresses: []string{"192.0.2.1"}, SourceOptions: timed}},
+			},
+			want: false,
+		},
+		{
+			name: "disabled source without timeout",
+			list: List{Sources: []Source{
+				{Type: SourceStatic, Addresses: []string{"192.0.2.1"}, SourceOptions: timed},
+				{Type: SourceStatic, Addresses: []string{"192.0.2.2"}, SourceOptions: SourceOptions{Enabled: &disabled}},
+			}},
+			want: false,
+		},
+		{
+			name: "domains with TTL timeout",
+			list: List{Domains: []string{"example.com"}, TTLTimeout: true},
+			want: false,
+		},
+		{
+			name: "domains",
+			list: List{Domains: []string{"example.com"}},
+			want: true,
+		},
+		{
+			name: "countries",
+			list: List{Countries: []string{"DE"}},
+			want: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.list.UsesListTimeout(); got != tt.want {
+				t.Errorf("List.UsesListTimeout() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestList_GetUpdateStrategy(t *testing.T) {
+	tests := []struct {
+		name string
+		list List
+		want string
+	}{
+		{
+			name: "default",
+			list: List{},
+			want: UpdateReplace,
+		},
+		{
+			name: "swap",
+			list: List{UpdateStrategy: UpdateSwap},
+			want: UpdateSwap,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := tt.list.GetUpdateStrategy()
+			if got != tt.want {
+				t.Errorf("List.GetUpdateStrategy() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
 func TestValidateConfig(t *testing.T) {
 	tests := []struct {
 		name    string
@@ -172,7 +462,7 @@ func TestValidateConfig(t *testing.T) {
 			cfg: &Config{
 				Lists: map[string]List{
 					"test": {
-						URLs: []string{"https://example.com"},
+						URLs: []URLSource{{URL: "https://example.com"}},
 					},
 				},
 			},
@@ -183,14 +473,228 @@ func TestValidateConfig(t *testing.T) {
 			cfg: &Config{
 				Lists: map[string]List{
 					"test": {
-						URLs:      []string{"https://example.com"},
-						Files:     []string{"/path/to/file"},
-						Addresses: []string{"192.168.1.1"},
+						URLs:      []URLSource{{URL: "https://example.com"}},
+						Files:     []FileSource{{Path: "/path/to/file"}},
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
 					},
 				},
 			},
 			wantErr: false,
 		},
+		{
+			name: "valid config with domains only",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Domains: []string{"example.com"},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "asns without asnData file",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						ASNs: []string{"AS13335"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid asn",
+			cfg: &Config{
+				Config: ConfigDefaults{
+					ASNData: ASNData{File: "/var/lib/asn.txt"},
+				},
+				Lists: map[string]List{
+					"test": {
+						ASNs: []string{"AS-CLOUDFLARE"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "countries without geoData files",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Countries: []string{"DE"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid country code",
+			cfg: &Config{
+				Config: ConfigDefaults{
+					GeoData: GeoData{Files: []string{"/var/lib/GeoLite2-Country.mmdb"}},
+				},
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+						Exclude:   Exclude{Countries: []string{"Germany"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid comment template",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						CommentTemplate: "{{.Prefix",
+						Addresses:       []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid source timeout",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						URLs: []URLSource{{URL: "https://example.com", SourceOptions: SourceOptions{Timeout: "forever"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid address group timeout",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}, SourceOptions: SourceOptions{Timeout: "soon"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid static address",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.256"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid static source address",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Sources: []Source{{Type: SourceStatic, Addresses: []string{"10.0.0.0/33"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "valid static address forms",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.0.2.1", "10.0.0.5/8", "2001:db8::/32", "192.0.2.10-192.0.2.20"}}},
+						Exclude:   Exclude{Addresses: []string{"10.1.0.0/16", "2001:db8::1"}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid exclude address",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+						Exclude:   Exclude{Addresses: []string{"192.0.2.20-192.0.2.10"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid global exclude address",
+			cfg: &Config{
+				Config: ConfigDefaults{
+					Exclude: Exclude{Addresses: []string{"10.0.0.0/8", "my-office"}},
+				},
+				Lists: map[string]List{
+					"test": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid domain",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Domains: []string{"api..example.com"},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "list name with quote",
+			cfg: &Config{
+				Lists: map[string]List{
+					`bad"name`: {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "list name with space",
+			cfg: &Config{
+				Lists: map[string]List{
+					"bad name": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "list name with dash and dot",
+			cfg: &Config{
+				Lists: map[string]List{
+					"block-list.v4": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+				},
+			},
+			wantErr: false,
+		},
+		{
+			name: "list names sharing a variable name",
+			cfg: &Config{
+				Lists: map[string]List{
+					"block-list": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+					},
+					"block_list": {
+						Addresses: []AddressGroup{{Addresses: []string{"192.168.1.2"}}},
+					},
+				},
+			},
+			wantErr: true,
+		},
 		{
 			name: "no lists",
 			cfg: &Config{
@@ -215,7 +719,55 @@ func TestValidateConfig(t *testing.T) {
 				},
 				Lists: map[string]List{
 					"test": {
-						URLs: []string{"https://example.com"},
+						URLs: []URLSource{{URL: "https://example.com"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid family",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Family: "ipv5",
+						URLs:   []URLSource{{URL: "https://example.com"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid refresh",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						Refresh: "often",
+						URLs:    []URLSource{{URL: "https://example.com"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid onError",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						OnError: "ignore",
+						URLs:    []URLSource{{URL: "https://example.com"}},
+					},
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "invalid updateStrategy",
+			cfg: &Config{
+				Lists: map[string]List{
+					"test": {
+						UpdateStrategy: "rename",
+						URLs:           []URLSource{{URL: "https://example.com"}},
 					},
 				},
 			},
@@ -230,7 +782,7 @@ func TestValidateConfig(t *testing.T) {
 				Lists: map[string]List{
 					"test": {
 						Timeout: "12h30m",
-						URLs:    []string{"https://example.com"},
+						URLs:    []URLSource{{URL: "https://example.com"}},
 					},
 				},
 			},
@@ -247,3 +799,36 @@ func TestValidateConfig(t *testing.T) {
 		})
 	}
 }
+
+func TestList_GetCommentTemplate(t *testing.T) {
+	tests := []struct {
+		name     string
+		list     List
+		defaults ConfigDefaults
+		want     string
+	}{
+		{
+			name: "package default",
+			want: DefaultCommentTemplate,
+		},
+		{
+			name:     "global template",
+			defaults: ConfigDefaults{CommentTemplate: "{{.Comment}}"},
+			want:     "{{.Comment}}",
+		},
+		{
+			name:     "list template overrides global",
+			list:     List{CommentTemplate: "{{.Prefix}}/{{.SourceName}}/{{.Comment}}"},
+			defaults: ConfigDefaults{CommentTemplate: "{{.Comment}}"},
+			want:     "{{.Prefix}}/{{.SourceName}}/{{.Comment}}",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.list.GetCommentTemplate(tt.defaults); got != tt.want {
+				t.Errorf("GetCommentTemplate() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,259 @@
+package config
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// durationUnits are the unit suffixes accepted by ParseDuration: Go's
+// units plus days and weeks.
+var durationUnits = map[string]time.Duration{
+	"ns": time.Nanosecond,
+	"us": time.Microsecond,
+	"µs": time.Microsecond, // U+00B5 micro sign
+	"μs": time.Microsecond, // U+03BC Greek small letter mu
+	"ms": time.Millisecond,
+	"s":  time.Second,
+	"m":  time.Minute,
+	"h":  time.Hour,
+	"d":  day,
+	"w":  week,
+}
+
+// durationAliases maps alternative spellings of a unit to the name it is
+// tracked under, so that a unit cannot be given twice under different names.
+var durationAliases = map[string]string{
+	"µs": "us",
+	"μs": "us",
+}
+
+// ParseDuration parses a positive duration in the configuration syntax.
+// A duration is a sequence of numbers with unit suffixes in any order,
+// such as "2w", "1d12h", "30m1h" or "1.5h", using the units of Go's
+// time.ParseDuration plus "d" and "w". It may end in RouterOS clock
+// notation, "hh:mm:ss" with optional fractional seconds, following
+// weeks and days only ("1d02:30:00", "00:00:01.500"). Everything
+// FormatDuration produces is accepted.
+func ParseDuration(s string) (time.Duration, error) {
+	if s == "" {
+		return 0, fmt.Errorf("empty duration string")
+	}
+
+	p := durationParser{s: s, seen: make(map[string]bool)}
+	duration, err := p.parse()
+	if err != nil {
+		return 0, err
+	}
+	if duration <= 0 {
+		return 0, fmt.Errorf("invalid duration: %s (zero duration)", s)
+	}
+	return duration, nil
+}
+
+// durationParser scans a duration string, keeping the position of the
+// current character for error messages.
+type durationParser struct {
+	s     string
+	pos   int
+	total time.Duration
+	seen  map[string]bool
+}
+
+func (p *durationParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid duration %q at position %d: %s", p.s, p.pos+1, fmt.Sprintf(format, args...))
+}
+
+// current describes the character at the current position.
+func (p *durationParser) current() string {
+	if p.pos >= len(p.s) {
+		return "end of input"
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.pos:])
+	return strconv.QuoteRune(r)
+}
+
+func (p *durationParser) parse() (time.Duration, error) {
+	for p.pos < len(p.s) {
+		start := p.pos
+		whole, ok := p.digits()
+		if !ok {
+			return 0, p.errorf("expected a number, found %s", p.current())
+		}
+
+		if p.pos < len(p.s) && p.s[p.pos] == ':' {
+			p.pos = start
+			if err := p.clock(); err != nil {
+				return 0, err
+			}
+			continue
+		}
+
+		var frac string
+		if p.pos < len(p.s) && p.s[p.pos] == '.' {
+			p.pos++
+			fracStart := p.pos
+			if _, ok := p.digits(); !ok {
+				return 0, p.errorf("expected digits after decimal point, found %s", p.current())
+			}
+			frac = p.s[fracStart:p.pos]
+		}
+
+		unitStart := p.pos
+		for p.pos < len(p.s) {
+			r, size := utf8.DecodeRuneInString(p.s[p.pos:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			p.pos += size
+		}
+		name := p.s[unitStart:p.pos]
+		if name == "" {
+			return 0, p.errorf("missing unit after %q (expected w, d, h, m, s, ms, us or ns)", p.s[start:p.pos])
+		}
+		unit, ok := durationUnits[name]
+		if !ok {
+			p.pos = unitStart
+			return 0, p.errorf("unknown unit %q (expected w, d, h, m, s, ms, us or ns)", name)
+		}
+		if err := p.add(unitStart, name, whole, frac, unit); err != nil {
+			return 0, err
+		}
+	}
+	return p.total, nil
+}
+
+// clock parses "hh:mm:ss" with optional fractional seconds, which must
+// end the duration and may only follow weeks and days.
+func (p *durationParser) clock() error {
+	for _, unit := range []string{"h", "m", "s", "ms", "us", "ns"} {
+		if p.seen[unit] {
+			return p.errorf("clock notation can only follow weeks and days")
+		}
+	}
+
+	hours, _ := p.digits()
+	fields := []string{hours}
+	for _, name := range []string{"minutes", "seconds"} {
+		if p.pos >= len(p.s) || p.s[p.pos] != ':' {
+			return p.errorf("expected ':' before %s, found %s", name, p.current())
+		}
+		p.pos++
+		start := p.pos
+		if _, ok := p.digits(); !ok || p.pos-start != 2 {
+			p.pos = start
+			return p.errorf("expected two digits of %s", name)
+		}
+		if p.s[start] > '5' {
+			p.pos = start
+			return p.errorf("%s must be below 60", name)
+		}
+		fields = append(fields, p.s[start:p.pos])
+	}
+
+	var frac string
+	if p.pos < len(p.s) && p.s[p.pos] == '.' {
+		p.pos++
+		start := p.pos
+		if _, ok := p.digits(); !ok {
+			return p.errorf("expected digits after decimal point, found %s", p.current())
+		}
+		frac = p.s[start:p.pos]
+	}
+	if p.pos < len(p.s) {
+		return p.errorf("unexpected %s after clock", p.current())
+	}
+
+	if err := p.add(p.pos, "h", fields[0], "", time.Hour); err != nil {
+		return err
+	}
+	if err := p.add(p.pos, "m", fields[1], "", time.Minute); err != nil {
+		return err
+	}
+	return p.add(p.pos, "s", fields[2], frac, time.Second)
+}
+
+// digits consumes a run of decimal digits and returns them.
+func (p *durationParser) digits() (string, bool) {
+	start := p.pos
+	for p.pos < len(p.s) && isDurationDigit(p.s[p.pos]) {
+		p.pos++
+	}
+	return p.s[start:p.pos], p.pos > start
+}
+
+// add adds whole.frac units to the total. Each unit may appear once.
+func (p *durationParser) add(pos int, name, whole, frac string, unit time.Duration) error {
+	key := name
+	if alias, ok := durationAliases[name]; ok {
+		key = alias
+	}
+	if p.seen[key] {
+		p.pos = pos
+		return p.errorf("unit %q given more than once", name)
+	}
+	p.seen[key] = true
+
+	n, err := strconv.ParseUint(whole, 10, 63)
+	if err != nil || n > uint64(math.MaxInt64/unit) {
+		p.pos = pos
+		return p.errorf("duration too large")
+	}
+	value := time.Duration(n) * unit
+	if frac != "" {
+		f, _ := strconv.ParseFloat("0."+frac, 64)
+		value += time.Duration(f * float64(unit))
+	}
+	if value > math.MaxInt64-p.total {
+		p.pos = pos
+		return p.errorf("duration too large")
+	}
+	p.total += value
+	return nil
+}
+
+func isDurationDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// FormatDuration renders d the way RouterOS prints durations: weeks and
+// days followed by an "hh:mm:ss" clock, as in "3d12:00:00". The clock is
+// left out when it is zero ("1w", "2d"), and milliseconds are appended to
+// it when present ("00:00:01.500"). Shorter units are truncated.
+func FormatDuration(d time.Duration) string {
+	if d < 0 {
+		d = 0
+	}
+	d = d.Truncate(time.Millisecond)
+
+	var b strings.Builder
+	if w := d / week; w > 0 {
+		fmt.Fprintf(&b, "%dw", w)
+		d -= w * week
+	}
+	if n := d / day; n > 0 {
+		fmt.Fprintf(&b, "%dd", n)
+		d -= n * day
+	}
+	if d == 0 && b.Len() > 0 {
+		return b.String()
+	}
+
+	h := d / time.Hour
+	m := d % time.Hour / time.Minute
+	sec := d % time.Minute / time.Second
+	fmt.Fprintf(&b, "%02d:%02d:%02d", h, m, sec)
+	if ms := d % time.Second / time.Millisecond; ms > 0 {
+		fmt.Fprintf(&b, ".%03d", ms)
+	}
+	return b.String()
+}
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"strings"
 	"testing"
 	"time"
 )
@@ -42,6 +43,102 @@ func TestParseDuration(t *testing.T) {
 			want:    51*time.Hour + 45*time.Minute + 30*time.Second,
 			wantErr: false,
 		},
+		{
+			name:    "weeks",
+			input:   "2w",
+			want:    14 * 24 * time.Hour,
+			wantErr: false,
+		},
+		{
+			name:    "routeros notation",
+			input:   "3d12:00:00",
+			want:    84 * time.Hour,
+			wantErr: false,
+		},
+		{
+			name:    "routeros clock only",
+			input:   "00:01:30",
+			want:    90 * time.Second,
+			wantErr: false,
+		},
+		{
+			name:    "routeros milliseconds",
+			input:   "1w00:00:01.5",
+			want:    7*24*time.Hour + 1500*time.Millisecond,
+			wantErr: false,
+		},
+		{
+			name:    "mixed order",
+			input:   "30m1h",
+			want:    90 * time.Minute,
+			wantErr: false,
+		},
+		{
+			name:    "fractional",
+			input:   "1.5h",
+			want:    90 * time.Minute,
+			wantErr: false,
+		},
+		{
+			name:    "milliseconds",
+			input:   "1s500ms",
+			want:    1500 * time.Millisecond,
+			wantErr: false,
+		},
+		{
+			name:    "go duration string",
+			input:   "2h45m0.5s",
+			want:    2*time.Hour + 45*time.Minute + 500*time.Millisecond,
+			wantErr: false,
+		},
+		{
+			name:    "weeks days and clock",
+			input:   "1w1d02:30:00",
+			want:    8*24*time.Hour + 150*time.Minute,
+			wantErr: false,
+		},
+		{
+			name:    "clock after hours",
+			input:   "1h02:30:00",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "repeated unit",
+			input:   "1h2h",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "repeated microseconds under different names",
+			input:   "1us1µs",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "repeated micro sign and Greek mu",
+			input:   "1µs1μs",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "clock after microseconds",
+			input:   "1μs00:00:01",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "negative",
+			input:   "-1h",
+			want:    0,
+			wantErr: true,
+		},
+		{
+			name:    "routeros minutes out of range",
+			input:   "01:60:00",
+			want:    0,
+			wantErr: true,
+		},
 		{
 			name:    "empty string",
 			input:   "",
@@ -70,14 +167,63 @@ func TestParseDuration(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := parseDuration(tt.input)
+			got, err := ParseDuration(tt.input)
 			if (err != nil) != tt.wantErr {
-				t.Errorf("parseDuration() error = %v, wantErr %v", err, tt.wantErr)
+				t.Errorf("ParseDuration() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
 			if got != tt.want {
-				t.Errorf("parseDuration() = %v, want %v", got, tt.want)
+				t.Errorf("ParseDuration() = %v, want %v", got, tt.want)
 			}
 		})
 	}
 }
+
+func TestParseDuration_ErrorPosition(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "12h3x", want: `at position 5: unknown unit "x"`},
+		{input: "1d 2h", want: `at position 3: expected a number, found ' '`},
+		{input: "15", want: `at position 3: missing unit after "15"`},
+		{input: "1d02:3:00", want: `at position 6: expected two digits of minutes`},
+		{input: "1d02:30:00x", want: `at position 11: unexpected 'x' after clock`},
+		{input: "1.h", want: `at position 3: expected digits after decimal point`},
+	}
+
+	for _, tt := range tests {
+		_, err := ParseDuration(tt.input)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("ParseDuration(%q) error = %v, want it to contain %q", tt.input, err, tt.want)
+		}
+	}
+}
+
+func TestFormatDuration(t *testing.T) {
+	tests := []struct {
+		input time.Duration
+		want  string
+	}{
+		{input: 84 * time.Hour, want: "3d12:00:00"},
+		{input: 24 * time.Hour, want: "1d"},
+		{input: 15 * 24 * time.Hour, want: "2w1d"},
+		{input: 90 * time.Second, want: "00:01:30"},
+		{input: 3*time.Hour + 59*time.Minute + 54*time.Second, want: "03:59:54"},
+		{input: 1500 * time.Millisecond, want: "00:00:01.500"},
+		{input: time.Second + 1234567, want: "00:00:01.001"},
+	}
+
+	for _, tt := range tests {
+		got := FormatDuration(tt.input)
+		if got != tt.want {
+			t.Errorf("FormatDuration(%v) = %q, want %q", tt.input, got, tt.want)
+			continue
+		}
+		// Every formatted duration parses back to the same value
+		parsed, err := ParseDuration(got)
+		if err != nil || parsed != tt.input.Truncate(time.Millisecond) {
+			t.Errorf("ParseDuration(%q) = %v, %v, want %v", got, parsed, err, tt.input.Truncate(time.Millisecond))
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Defaults applied to URL fetching when neither the list nor the global
+// configuration overrides them.
+const (
+	DefaultFetchTimeout = 30 * time.Second
+	DefaultRetryBackoff = time.Second
+	DefaultMaxBodySize  = 64 << 20
+)
+
+// DefaultContentTypes are the media types accepted from upstream feeds
+// unless contentTypes is configured. Responses without a Content-Type
+// header are always accepted.
+var DefaultContentTypes = []string{
+	"text/plain",
+	"text/csv",
+	"application/json",
+	"application/octet-stream",
+}
+
+// Fetch configures how URL sources are downloaded. Unset fields fall back
+// to the global configuration and then to the package defaults.
+type Fetch struct {
+	Timeout      string   `yaml:"timeout,omitempty"`
+	Retries      *int     `yaml:"retries,omitempty"`
+	RetryBackoff string   `yaml:"retryBackoff,omitempty"`
+	MaxBodySize  int64    `yaml:"maxBodySize,omitempty"`
+	ContentTypes []string `yaml:"contentTypes,omitempty"`
+}
+
+// FetchOptions is the resolved form of Fetch.
+type FetchOptions struct {
+	Timeout      time.Duration
+	Retries      int
+	RetryBackoff time.Duration
+	MaxBodySize  int64
+	ContentTypes []string
+}
+
+// GetFetch resolves the fetch options of the list's URL sources.
+func (l *List) GetFetch(defaults ConfigDefaults) (FetchOptions, error) {
+	opts, err := defaults.GetFetch()
+	if err != nil {
+		return FetchOptions{}, err
+	}
+	return l.Fetch.apply(opts)
+}
+
+// GetFetch resolves the global fetch options.
+func (d ConfigDefaults) GetFetch() (FetchOptions, error) {
+	opts := FetchOptions{
+		Timeout:      DefaultFetchTimeout,
+		RetryBackoff: DefaultRetryBackoff,
+		MaxBodySize:  DefaultMaxBodySize,
+		ContentTypes: DefaultContentTypes,
+	}
+	return d.Fetch.apply(opts)
+}
+
+func (f Fetch) apply(opts FetchOptions) (FetchOptions, error) {
+	if f.Timeout != "" {
+		timeout, err := ParseDuration(f.Timeout)
+		if err != nil {
+			return FetchOptions{}, fmt.Errorf("invalid fetch timeout: %v", err)
+		}
+		opts.Timeout = timeout
+	}
+
+	if f.Retries != nil {
+		if *f.Retries < 0 {
+			return FetchOptions{}, fmt.Errorf("invalid fetch retries: %d", *f.Retries)
+		}
+		opts.Retries = *f.Retries
+	}
+
+	if f.RetryBackoff != "" {
+		backoff, err := ParseDuration(f.RetryBackoff)
+		if err != nil {
+			return FetchOptions{}, fmt.Errorf("invalid fetch retryBackoff: %v", err)
+		}
+		opts.RetryBackoff = backoff
+	}
+
+	if f.MaxBodySize < 0 {
+		return FetchOptions{}, fmt.Errorf("invalid fetch maxBodySize: %d", f.MaxBodySize)
+	}
+	if f.MaxBodySize > 0 {
+		opts.MaxBodySize = f.MaxBodySize
+	}
+
+	if len(f.ContentTypes) > 0 {
+		opts.ContentTypes = f.ContentTypes
+	}
+
+	return opts, nil
+}
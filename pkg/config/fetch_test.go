@@ -0,0 +1,102 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestList_GetFetch(t *testing.T) {
+	three := 3
+	zero := 0
+
+	tests := []struct {
+		name     string
+		list     List
+		defaults ConfigDefaults
+		want     FetchOptions
+		wantErr  bool
+	}{
+		{
+			name: "package defaults",
+			want: FetchOptions{
+				Timeout:      DefaultFetchTimeout,
+				RetryBackoff: DefaultRetryBackoff,
+				MaxBodySize:  DefaultMaxBodySize,
+				ContentTypes: DefaultContentTypes,
+			},
+		},
+		{
+			name: "global overrides",
+			defaults: ConfigDefaults{
+				Fetch: Fetch{
+					Timeout:      "10s",
+					Retries:      &three,
+					RetryBackoff: "2s",
+					MaxBodySize:  1024,
+					ContentTypes: []string{"text/plain"},
+				},
+			},
+			want: FetchOptions{
+				Timeout:      10 * time.Second,
+				Retries:      3,
+				RetryBackoff: 2 * time.Second,
+				MaxBodySize:  1024,
+				ContentTypes: []string{"text/plain"},
+			},
+		},
+		{
+			name: "list overrides global",
+			list: List{
+				Fetch: Fetch{
+					Timeout: "1m",
+					Retries: &zero,
+				},
+			},
+			defaults: ConfigDefaults{
+				Fetch: Fetch{
+					Timeout: "10s",
+					Retries: &three,
+				},
+			},
+			want: FetchOptions{
+				Timeout:      time.Minute,
+				Retries:      0,
+				RetryBackoff: DefaultRetryBackoff,
+				MaxBodySize:  DefaultMaxBodySize,
+				ContentTypes: DefaultContentTypes,
+			},
+		},
+		{
+			name: "invalid timeout",
+			list: List{
+				Fetch: Fetch{Timeout: "soon"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative body size",
+			defaults: ConfigDefaults{
+				Fetch: Fetch{MaxBodySize: -1},
+			},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.list.GetFetch(tt.defaults)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("List.GetFetch() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Timeout != tt.want.Timeout || got.Retries != tt.want.Retries ||
+				got.RetryBackoff != tt.want.RetryBackoff || got.MaxBodySize != tt.want.MaxBodySize ||
+				len(got.ContentTypes) != len(tt.want.ContentTypes) {
+				t.Errorf("List.GetFetch() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// GeoData configures the local GeoIP country database used by countries
+// sources and exclusions. Files are MaxMind DB (.mmdb) or CSV files;
+// Locations is the GeoLite2 locations CSV needed to resolve the geoname
+// IDs of GeoLite2 CSV block files.
+type GeoData struct {
+	Files     []string `yaml:"files"`
+	Locations string   `yaml:"locations,omitempty"`
+	Refresh   string   `yaml:"refresh,omitempty"`
+}
+
+// GetRefresh returns how often the GeoIP files are reloaded, or zero if
+// they are only loaded once.
+func (g GeoData) GetRefresh() (time.Duration, error) {
+	if g.Refresh == "" {
+		return 0, nil
+	}
+	return ParseDuration(g.Refresh)
+}
+
+// ParseCountry validates an ISO 3166-1 alpha-2 country code and returns it
+// in upper case.
+func ParseCountry(s string) (string, error) {
+	code := strings.ToUpper(strings.TrimSpace(s))
+	if len(code) != 2 || code[0] < 'A' || code[0] > 'Z' || code[1] < 'A' || code[1] > 'Z' {
+		return "", fmt.Errorf("invalid country code: %q", s)
+	}
+	return code, nil
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// HTTP configures how a URL source is requested: extra headers,
+// credentials, TLS client certificates and trust, and the proxy.
+type HTTP struct {
+	Headers     map[string]string `yaml:"headers,omitempty"`
+	BasicAuth   *BasicAuth        `yaml:"basicAuth,omitempty"`
+	BearerToken string            `yaml:"bearerToken,omitempty"`
+	TLS         `yaml:",inline"`
+}
+
+// BasicAuth holds HTTP basic authentication credentials.
+type BasicAuth struct {
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+// TLS holds the transport settings of a URL source. Sources with the same
+// settings share an HTTP client.
+type TLS struct {
+	// ClientCert and ClientKey are PEM files presented for mutual TLS.
+	ClientCert string `yaml:"clientCert,omitempty"`
+	ClientKey  string `yaml:"clientKey,omitempty"`
+	// CABundle is a PEM file of certificate authorities trusted instead
+	// of the system roots.
+	CABundle           string `yaml:"caBundle,omitempty"`
+	InsecureSkipVerify bool   `yaml:"insecureSkipVerify,omitempty"`
+	// Proxy is the URL of the HTTP proxy to use. By default the
+	// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables apply.
+	Proxy string `yaml:"proxy,omitempty"`
+}
+
+func (h HTTP) validate() error {
+	if h.BasicAuth != nil && h.BearerToken != "" {
+		return fmt.Errorf("basicAuth and bearerToken are mutually exclusive")
+	}
+	if h.BasicAuth != nil && h.BasicAuth.Username == "" {
+		return fmt.Errorf("basicAuth without username")
+	}
+	if (h.ClientCert == "") != (h.ClientKey == "") {
+		return fmt.Errorf("clientCert and clientKey must be set together")
+	}
+	if h.Proxy != "" {
+		u, err := url.Parse(h.Proxy)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid proxy URL %q", h.Proxy)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,194 @@
+package config
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync/atomic"
+
+	"gopkg.in/yaml.v3"
+)
+
+// redacted replaces secrets in logs and API responses.
+const redacted = "[REDACTED]"
+
+// minSecretLength is the length below which expanded values are not
+// redacted, since replacing every occurrence of a digit or a short word
+// would garble logs without protecting anything.
+const minSecretLength = 4
+
+// credentialKeys are the configuration keys whose values may carry
+// credentials: URLs, request headers, authentication settings and proxies.
+// Environment variables are only treated as secrets below these keys.
+var credentialKeys = map[string]bool{
+	"url":         true,
+	"urls":        true,
+	"location":    true,
+	"proxy":       true,
+	"headers":     true,
+	"basicAuth":   true,
+	"username":    true,
+	"password":    true,
+	"bearerToken": true,
+}
+
+// interpolate expands ${NAME} environment variable and ${file:/path}
+// secret file references in every scalar of a YAML document. "$${" is
+// written as a literal "${". The values of secret files and of variables
+// used in credentials are returned so that they can be redacted.
+func interpolate(node *yaml.Node, path string) ([]string, error) {
+	var secrets []string
+	var walk func(n *yaml.Node, sensitive bool) error
+	walk = func(n *yaml.Node, sensitive bool) error {
+		if n.Kind == yaml.ScalarNode && strings.Contains(n.Value, "${") {
+			value, values, err := expand(n.Value, sensitive)
+			if err != nil {
+				return fmt.Errorf("%s:%d: %v", path, n.Line, err)
+			}
+			n.Value = value
+			// Let plain scalars be resolved again, so "${PORT}" can be a number
+			if n.Style == 0 {
+				n.Tag = ""
+			}
+			for _, v := range values {
+				if len(v) >= minSecretLength {
+					secrets = append(secrets, v)
+				}
+			}
+		}
+		switch n.Kind {
+		case yaml.MappingNode:
+			for i := 0; i+1 < len(n.Content); i += 2 {
+				key, value := n.Content[i], n.Content[i+1]
+				if err := walk(key, false); err != nil {
+					return err
+				}
+				if err := walk(value, sensitive || credentialKeys[key.Value]); err != nil {
+					return err
+				}
+			}
+		default:
+			for _, child := range n.Content {
+				// Items of urls: written as mappings name their credentials
+				// themselves, so the parent key only covers plain items
+				if err := walk(child, sensitive && child.Kind == yaml.ScalarNode); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+	err := walk(node, false)
+	return secrets, err
+}
+
+// expand replaces the references in s. It returns the values of secret
+// files it used, and of environment variables too if sensitive is set.
+func expand(s string, sensitive bool) (string, []string, error) {
+	var b strings.Builder
+	var values []string
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			b.WriteString(s)
+			return b.String(), values, nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			b.WriteString(s[:i-1] + "${")
+			s = s[i+2:]
+			continue
+		}
+		end := strings.IndexByte(s[i:], '}')
+		if end < 0 {
+			return "", nil, fmt.Errorf("unterminated reference in %q", s)
+		}
+		ref := s[i+2 : i+end]
+
+		value, err := resolveReference(ref)
+		if err != nil {
+			return "", nil, err
+		}
+		b.WriteString(s[:i])
+		b.WriteString(value)
+		if value != "" && (sensitive || strings.HasPrefix(ref, "file:")) {
+			values = append(values, value)
+		}
+		s = s[i+end+1:]
+	}
+}
+
+// resolveReference returns the value of an environment variable, or the
+// contents of a file for "file:" references, without trailing newlines.
+func resolveReference(ref string) (string, error) {
+	if path, ok := strings.CutPrefix(ref, "file:"); ok {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return "", fmt.Errorf("reading secret file: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	}
+
+	if ref == "" {
+		return "", fmt.Errorf("empty reference ${}")
+	}
+	value, ok := os.LookupEnv(ref)
+	if !ok {
+		return "", fmt.Errorf("undefined environment variable %s", ref)
+	}
+	return value, nil
+}
+
+// Redact replaces every value the configuration took from secret files,
+// or from environment variables in credentials, in s.
+func (c *Config) Redact(s string) string {
+	if len(c.Secrets) == 0 {
+		return s
+	}
+	return secretReplacer(c.Secrets).Replace(s)
+}
+
+func secretReplacer(secrets []string) *strings.Replacer {
+	// Longer secrets first, so one containing another is fully replaced
+	sorted := append([]string(nil), secrets...)
+	sort.Slice(sorted, func(i, j int) bool { return len(sorted[i]) > len(sorted[j]) })
+
+	pairs := make([]string, 0, 2*len(sorted))
+	for _, secret := range sorted {
+		pairs = append(pairs, secret, redacted)
+	}
+	return strings.NewReplacer(pairs...)
+}
+
+// RedactingWriter writes through to another writer with the secrets of
+// the current configuration replaced. It is meant for log.SetOutput.
+type RedactingWriter struct {
+	w        io.Writer
+	replacer atomic.Pointer[strings.Replacer]
+}
+
+func NewRedactingWriter(w io.Writer) *RedactingWriter {
+	return &RedactingWriter{w: w}
+}
+
+// SetSecrets replaces the values that are redacted, typically after the
+// configuration was reloaded.
+func (r *RedactingWriter) SetSecrets(secrets []string) {
+	if len(secrets) == 0 {
+		r.replacer.Store(nil)
+		return
+	}
+	r.replacer.Store(secretReplacer(secrets))
+}
+
+func (r *RedactingWriter) Write(p []byte) (int, error) {
+	replacer := r.replacer.Load()
+	if replacer == nil {
+		return r.w.Write(p)
+	}
+	if _, err := io.WriteString(r.w, replacer.Replace(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
@@ -0,0 +1,302 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats understood by the parsers of URL and file sources.
+const (
+	FormatAuto         = "auto"
+	FormatPlain        = "plain"
+	FormatCSV          = "csv"
+	FormatJSON         = "json"
+	FormatSpamhausDrop = "spamhaus-drop"
+	FormatIPsum        = "ipsum"
+)
+
+// Parser selects how the contents of a URL or file source are parsed.
+// An empty format detects it from the contents.
+type Parser struct {
+	Format string `yaml:"format,omitempty"`
+	// Column is the 1-based CSV column holding the address (default 1).
+	Column int `yaml:"column,omitempty"`
+	// Selector picks the addresses out of JSON documents, e.g.
+	// "$.data[*].ipAddress". Without it every string that parses as an
+	// address is used.
+	Selector string `yaml:"selector,omitempty"`
+	// Threshold is the minimum hit count of ipsum entries, the same as
+	// minScore for that format.
+	Threshold int `yaml:"threshold,omitempty"`
+	// ScoreColumn is the 1-based column holding a score, for CSV files and
+	// whitespace separated plain lines.
+	ScoreColumn int `yaml:"scoreColumn,omitempty"`
+	// ScoreField is the field holding a score in the JSON objects the
+	// selector picks addresses from.
+	ScoreField string `yaml:"scoreField,omitempty"`
+	// MinScore leaves out addresses scored below it.
+	MinScore float64 `yaml:"minScore,omitempty"`
+	// CommentColumn is the 1-based CSV column holding a comment.
+	CommentColumn int `yaml:"commentColumn,omitempty"`
+	// CommentField is the field holding a comment in the JSON objects the
+	// selector picks addresses from.
+	CommentField string `yaml:"commentField,omitempty"`
+}
+
+// Types of the entries of a sources: list.
+const (
+	SourceURL    = "url"
+	SourceFile   = "file"
+	SourceStatic = "static"
+)
+
+// SourceOptions are the settings shared by URL, file and static sources.
+type SourceOptions struct {
+	// Name replaces the default source name ("external", "file" or
+	// "static") in entry comments.
+	Name string `yaml:"name,omitempty"`
+	// Comment is used for entries the source gives no comment of its own.
+	Comment string `yaml:"comment,omitempty"`
+	Timeout string `yaml:"timeout,omitempty"`
+	// OnError overrides the failure policy of the list for this source.
+	OnError string `yaml:"onError,omitempty"`
+	// Enabled set to false leaves the source out without removing it from
+	// the configuration.
+	Enabled *bool `yaml:"enabled,omitempty"`
+}
+
+// URLSource is a URL to fetch addresses from. In YAML it is either the
+// URL itself or a mapping with a url key, source options, parser settings
+// and HTTP request settings.
+type URLSource struct {
+	URL           string `yaml:"url"`
+	SourceOptions `yaml:",inline"`
+	Parser        `yaml:",inline"`
+	HTTP          `yaml:",inline"`
+}
+
+func (s *URLSource) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = URLSource{URL: value.Value}
+		return nil
+	}
+	type plain URLSource
+	return value.Decode((*plain)(s))
+}
+
+// FileSource is a local file to read addresses from. In YAML it is either
+// the path itself or a mapping with a path key, source options and parser
+// settings.
+type FileSource struct {
+	Path          string `yaml:"path"`
+	SourceOptions `yaml:",inline"`
+	Parser        `yaml:",inline"`
+}
+
+func (s *FileSource) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*s = FileSource{Path: value.Value}
+		return nil
+	}
+	type plain FileSource
+	return value.Decode((*plain)(s))
+}
+
+// AddressGroup is a set of static addresses sharing a timeout. In YAML it
+// is either a single address or a mapping with addresses and source
+// options.
+type AddressGroup struct {
+	Addresses     []string `yaml:"addresses"`
+	SourceOptions `yaml:",inline"`
+}
+
+func (g *AddressGroup) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*g = AddressGroup{Addresses: []string{value.Value}}
+		return nil
+	}
+	type plain AddressGroup
+	return value.Decode((*plain)(g))
+}
+
+// Source is an entry of the sources: list of a list, describing a URL,
+// file or static source by its type and location. It takes the same
+// options as the urls:, files: and addresses: entries of that type.
+type Source struct {
+	Type string `yaml:"type"`
+	// Location is the URL, the path or a static address.
+	Location string `yaml:"location,omitempty"`
+	// Addresses holds the static addresses of a static source, in
+	// addition to its location.
+	Addresses     []string `yaml:"addresses,omitempty"`
+	SourceOptions `yaml:",inline"`
+	Parser        `yaml:",inline"`
+	HTTP          `yaml:",inline"`
+}
+
+func (s Source) urlSource() URLSource {
+	return URLSource{URL: s.Location, SourceOptions: s.SourceOptions, Parser: s.Parser, HTTP: s.HTTP}
+}
+
+func (s Source) fileSource() FileSource {
+	return FileSource{Path: s.Location, SourceOptions: s.SourceOptions, Parser: s.Parser}
+}
+
+func (s Source) addressGroup() AddressGroup {
+	var addresses []string
+	if s.Location != "" {
+		addresses = append(addresses, s.Location)
+	}
+	return AddressGroup{Addresses: append(addresses, s.Addresses...), SourceOptions: s.SourceOptions}
+}
+
+// IsEnabled reports whether the source is used. Sources are enabled
+// unless they set enabled: false.
+func (o SourceOptions) IsEnabled() bool {
+	return o.Enabled == nil || *o.Enabled
+}
+
+// GetName returns the name of the source, or fallback if none is set.
+func (o SourceOptions) GetName(fallback string) string {
+	if o.Name != "" {
+		return o.Name
+	}
+	return fallback
+}
+
+// GetOnError returns the failure policy of the source, or fallback if
+// none is set on the source.
+func (o SourceOptions) GetOnError(fallback string) string {
+	if o.OnError != "" {
+		return o.OnError
+	}
+	return fallback
+}
+
+func (o SourceOptions) validate() error {
+	if _, err := o.GetTimeout(0); err != nil {
+		return fmt.Errorf("invalid timeout: %v", err)
+	}
+	if err := validateOnError(o.OnError); err != nil {
+		return fmt.Errorf("invalid onError: %v", err)
+	}
+	return nil
+}
+
+func (p Parser) validate() error {
+	switch p.Format {
+	case "", FormatAuto, FormatPlain, FormatCSV, FormatJSON, FormatSpamhausDrop, FormatIPsum:
+	default:
+		return fmt.Errorf("unknown format %s (expected auto, plain, csv, json, spamhaus-drop or ipsum)", p.Format)
+	}
+	if p.Column < 0 {
+		return fmt.Errorf("invalid column: %d", p.Column)
+	}
+	if p.Threshold < 0 {
+		return fmt.Errorf("invalid threshold: %d", p.Threshold)
+	}
+	if p.ScoreColumn < 0 {
+		return fmt.Errorf("invalid scoreColumn: %d", p.ScoreColumn)
+	}
+	if p.ScoreField != "" && p.Selector == "" {
+		return fmt.Errorf("scoreField needs a selector")
+	}
+	if p.CommentColumn < 0 {
+		return fmt.Errorf("invalid commentColumn: %d", p.CommentColumn)
+	}
+	if p.CommentField != "" && p.Selector == "" {
+		return fmt.Errorf("commentField needs a selector")
+	}
+
+	// Only ipsum feeds carry a score without being told where it is
+	scored := p.ScoreColumn > 0 || p.ScoreField != "" ||
+		p.Format == FormatIPsum || p.Format == FormatAuto || p.Format == ""
+	if p.MinScore != 0 && !scored {
+		return fmt.Errorf("minScore needs scoreColumn or scoreField")
+	}
+	return nil
+}
+
+// validateSources checks the URL and file sources of a list or exclusion.
+func validateSources(urls []URLSource, files []FileSource) error {
+	for _, u := range urls {
+		if u.URL == "" {
+			return fmt.Errorf("url source without url")
+		}
+		if err := u.Parser.validate(); err != nil {
+			return fmt.Errorf("url %s: %v", u.URL, err)
+		}
+		if err := u.SourceOptions.validate(); err != nil {
+			return fmt.Errorf("url %s: %v", u.URL, err)
+		}
+		if err := u.HTTP.validate(); err != nil {
+			return fmt.Errorf("url %s: %v", u.URL, err)
+		}
+	}
+	for _, f := range files {
+		if f.Path == "" {
+			return fmt.Errorf("file source without path")
+		}
+		if err := f.Parser.validate(); err != nil {
+			return fmt.Errorf("file %s: %v", f.Path, err)
+		}
+		if err := f.SourceOptions.validate(); err != nil {
+			return fmt.Errorf("file %s: %v", f.Path, err)
+		}
+	}
+	return nil
+}
+
+// validateAddressGroups checks the static address groups of a list.
+func validateAddressGroups(groups []AddressGroup) error {
+	for _, g := range groups {
+		if len(g.Addresses) == 0 {
+			return fmt.Errorf("address group without addresses")
+		}
+		if err := g.SourceOptions.validate(); err != nil {
+			return fmt.Errorf("address group %s: %v", g.Addresses[0], err)
+		}
+		if err := validateAddresses(g.Addresses); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validateSourceList checks the entries of the sources: list of a list.
+func validateSourceList(sources []Source) error {
+	for i, s := range sources {
+		switch s.Type {
+		case SourceURL, SourceFile, SourceStatic:
+		default:
+			return fmt.Errorf("source %d has unknown type %q (expected url, file or static)", i+1, s.Type)
+		}
+		if s.Location == "" && (s.Type != SourceStatic || len(s.Addresses) == 0) {
+			return fmt.Errorf("source %d has no location", i+1)
+		}
+		if s.Type != SourceStatic && len(s.Addresses) > 0 {
+			return fmt.Errorf("%s source %s: addresses are only allowed on static sources", s.Type, s.Location)
+		}
+		var err error
+		switch s.Type {
+		case SourceURL:
+			err = validateSources([]URLSource{s.urlSource()}, nil)
+		case SourceFile:
+			if !reflect.DeepEqual(s.HTTP, HTTP{}) {
+				return fmt.Errorf("file source %s: HTTP settings are only allowed on url sources", s.Location)
+			}
+			err = validateSources(nil, []FileSource{s.fileSource()})
+		case SourceStatic:
+			if !reflect.DeepEqual(s.HTTP, HTTP{}) || s.Parser != (Parser{}) {
+				return fmt.Errorf("static source %s: parser and HTTP settings are only allowed on url and file sources", s.addressGroup().Addresses[0])
+			}
+			err = validateAddressGroups([]AddressGroup{s.addressGroup()})
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
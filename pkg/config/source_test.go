@@ -0,0 +1,321 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+func TestList_UnmarshalSources(t *testing.T) {
+	input := `
+urls:
+  - https://example.com/plain.txt
+  - url: https://example.com/drop.txt
+    format: spamhaus-drop
+  - url: https://intel.example.com/feed.json
+    format: json
+    headers:
+      X-Api-Key: key
+    basicAuth:
+      username: user
+      password: pass
+    caBundle: /etc/feeds/ca.pem
+files:
+  - /etc/lists/plain.txt
+  - path: /etc/lists/export.csv
+    format: csv
+    column: 2
+`
+	var list List
+	if err := yaml.Unmarshal([]byte(input), &list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	wantURLs := []URLSource{
+		{URL: "https://example.com/plain.txt"},
+		{URL: "https://example.com/drop.txt", Parser: Parser{Format: FormatSpamhausDrop}},
+		{
+			URL:    "https://intel.example.com/feed.json",
+			Parser: Parser{Format: FormatJSON},
+			HTTP: HTTP{
+				Headers:   map[string]string{"X-Api-Key": "key"},
+				BasicAuth: &BasicAuth{Username: "user", Password: "pass"},
+				TLS:       TLS{CABundle: "/etc/feeds/ca.pem"},
+			},
+		},
+	}
+	wantFiles := []FileSource{
+		{Path: "/etc/lists/plain.txt"},
+		{Path: "/etc/lists/export.csv", Parser: Parser{Format: FormatCSV, Column: 2}},
+	}
+
+	if len(list.URLs) != len(wantURLs) {
+		t.Fatalf("Unmarshal() urls = %v, want %v", list.URLs, wantURLs)
+	}
+	for i := range wantURLs {
+		if !reflect.DeepEqual(list.URLs[i], wantURLs[i]) {
+			t.Errorf("Unmarshal() urls[%d] = %+v, want %+v", i, list.URLs[i], wantURLs[i])
+		}
+	}
+	if len(list.Files) != len(wantFiles) {
+		t.Fatalf("Unmarshal() files = %v, want %v", list.Files, wantFiles)
+	}
+	for i := range wantFiles {
+		if list.Files[i] != wantFiles[i] {
+			t.Errorf("Unmarshal() files[%d] = %+v, want %+v", i, list.Files[i], wantFiles[i])
+		}
+	}
+}
+
+func TestList_UnmarshalAddresses(t *testing.T) {
+	input := `
+addresses:
+  - 192.0.2.1
+  - timeout: permanent
+    addresses:
+      - 10.0.0.0/8
+      - 192.168.0.0/16
+`
+	var list List
+	if err := yaml.Unmarshal([]byte(input), &list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	want := []AddressGroup{
+		{Addresses: []string{"192.0.2.1"}},
+		{Addresses: []string{"10.0.0.0/8", "192.168.0.0/16"}, SourceOptions: SourceOptions{Timeout: TimeoutPermanent}},
+	}
+	if len(list.Addresses) != len(want) {
+		t.Fatalf("Unmarshal() addresses = %v, want %v", list.Addresses, want)
+	}
+	for i := range want {
+		got := list.Addresses[i]
+		if got.Timeout != want[i].Timeout || strings.Join(got.Addresses, ",") != strings.Join(want[i].Addresses, ",") {
+			t.Errorf("Unmarshal() addresses[%d] = %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestParseTimeout(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    time.Duration
+		wantErr bool
+	}{
+		{input: "none", want: 0},
+		{input: "permanent", want: 0},
+		{input: "2h", want: 2 * time.Hour},
+		{input: "1500ms", want: 1500 * time.Millisecond},
+		{input: "forever", wantErr: true},
+		{input: "", wantErr: true},
+		{input: "500ms", wantErr: true},
+		{input: "500us", wantErr: true},
+		{input: "00:00:00.500", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseTimeout(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseTimeout(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseTimeout(%q) = %v, want %v", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestValidateSources(t *testing.T) {
+	tests := []struct {
+		name    string
+		urls    []URLSource
+		files   []FileSource
+		wantErr bool
+	}{
+		{
+			name:  "known formats",
+			urls:  []URLSource{{URL: "https://example.com", Parser: Parser{Format: FormatJSON, Selector: "$.data[*].ip"}}},
+			files: []FileSource{{Path: "/tmp/list.txt", Parser: Parser{Format: FormatIPsum, Threshold: 3}}},
+		},
+		{
+			name: "authenticated url",
+			urls: []URLSource{{URL: "https://example.com", HTTP: HTTP{
+				BearerToken: "token",
+				TLS:         TLS{ClientCert: "/etc/feeds/client.pem", ClientKey: "/etc/feeds/client.key", Proxy: "http://proxy:3128"},
+			}}},
+		},
+		{
+			name:    "basic auth and bearer token",
+			urls:    []URLSource{{URL: "https://example.com", HTTP: HTTP{BasicAuth: &BasicAuth{Username: "user"}, BearerToken: "token"}}},
+			wantErr: true,
+		},
+		{
+			name:    "client cert without key",
+			urls:    []URLSource{{URL: "https://example.com", HTTP: HTTP{TLS: TLS{ClientCert: "/etc/feeds/client.pem"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid proxy",
+			urls:    []URLSource{{URL: "https://example.com", HTTP: HTTP{TLS: TLS{Proxy: "proxy:3128"}}}},
+			wantErr: true,
+		},
+		{
+			name:    "unknown format",
+			urls:    []URLSource{{URL: "https://example.com", Parser: Parser{Format: "xml"}}},
+			wantErr: true,
+		},
+		{
+			name:    "negative column",
+			files:   []FileSource{{Path: "/tmp/list.csv", Parser: Parser{Format: FormatCSV, Column: -1}}},
+			wantErr: true,
+		},
+		{
+			name:  "min score with score column",
+			files: []FileSource{{Path: "/tmp/list.csv", Parser: Parser{Format: FormatCSV, ScoreColumn: 2, MinScore: 50}}},
+		},
+		{
+			name:    "min score without score",
+			urls:    []URLSource{{URL: "https://example.com", Parser: Parser{Format: FormatSpamhausDrop, MinScore: 1}}},
+			wantErr: true,
+		},
+		{
+			name:    "score field without selector",
+			urls:    []URLSource{{URL: "https://example.com", Parser: Parser{Format: FormatJSON, ScoreField: "score"}}},
+			wantErr: true,
+		},
+		{
+			name:    "missing url",
+			urls:    []URLSource{{Parser: Parser{Format: FormatPlain}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSources(tt.urls, tt.files)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSources() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestList_UnmarshalSourceList(t *testing.T) {
+	input := `
+urls:
+  - https://example.com/list1.txt
+sources:
+  - type: url
+    name: ipsum
+    location: https://example.com/ipsum.txt
+    format: ipsum
+    minScore: 3
+    onError: stale
+  - type: file
+    name: local
+    location: /etc/lists/local.txt
+    comment: office
+    timeout: 2h
+  - type: static
+    name: partners
+    addresses: [192.0.2.0/24, 198.51.100.0/24]
+    timeout: none
+  - type: url
+    location: https://example.com/disabled.txt
+    enabled: false
+`
+	var list List
+	if err := yaml.Unmarshal([]byte(input), &list); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+
+	disabled := false
+	wantSources := []Source{
+		{Type: SourceURL, Location: "https://example.com/ipsum.txt", SourceOptions: SourceOptions{Name: "ipsum", OnError: OnErrorStale}, Parser: Parser{Format: FormatIPsum, MinScore: 3}},
+		{Type: SourceFile, Location: "/etc/lists/local.txt", SourceOptions: SourceOptions{Name: "local", Comment: "office", Timeout: "2h"}},
+		{Type: SourceStatic, Addresses: []string{"192.0.2.0/24", "198.51.100.0/24"}, SourceOptions: SourceOptions{Name: "partners", Timeout: TimeoutNone}},
+		{Type: SourceURL, Location: "https://example.com/disabled.txt", SourceOptions: SourceOptions{Enabled: &disabled}},
+	}
+	if !reflect.DeepEqual(list.Sources, wantSources) {
+		t.Fatalf("Unmarshal() sources = %+v, want %+v", list.Sources, wantSources)
+	}
+
+	wantURLs := []URLSource{
+		{URL: "https://example.com/list1.txt"},
+		{URL: "https://example.com/ipsum.txt", SourceOptions: SourceOptions{Name: "ipsum", OnError: OnErrorStale}, Parser: Parser{Format: FormatIPsum, MinScore: 3}},
+	}
+	if got := list.GetURLs(); !reflect.DeepEqual(got, wantURLs) {
+		t.Errorf("GetURLs() = %+v, want %+v", got, wantURLs)
+	}
+	wantFiles := []FileSource{
+		{Path: "/etc/lists/local.txt", SourceOptions: SourceOptions{Name: "local", Comment: "office", Timeout: "2h"}},
+	}
+	if got := list.GetFiles(); !reflect.DeepEqual(got, wantFiles) {
+		t.Errorf("GetFiles() = %+v, want %+v", got, wantFiles)
+	}
+	wantGroups := []AddressGroup{
+		{Addresses: []string{"192.0.2.0/24", "198.51.100.0/24"}, SourceOptions: SourceOptions{Name: "partners", Timeout: TimeoutNone}},
+	}
+	if got := list.GetAddresses(); !reflect.DeepEqual(got, wantGroups) {
+		t.Errorf("GetAddresses() = %+v, want %+v", got, wantGroups)
+	}
+}
+
+func TestValidateSourceList(t *testing.T) {
+	tests := []struct {
+		name    string
+		sources []Source
+		wantErr bool
+	}{
+		{
+			name: "valid sources",
+			sources: []Source{
+				{Type: SourceURL, Location: "https://example.com", HTTP: HTTP{BearerToken: "token"}},
+				{Type: SourceFile, Location: "/etc/lists/local.txt", Parser: Parser{Format: FormatCSV, Column: 2}},
+				{Type: SourceStatic, Location: "192.0.2.1"},
+			},
+		},
+		{
+			name:    "unknown type",
+			sources: []Source{{Type: "ftp", Location: "ftp://example.com"}},
+			wantErr: true,
+		},
+		{
+			name:    "missing location",
+			sources: []Source{{Type: SourceURL}},
+			wantErr: true,
+		},
+		{
+			name:    "addresses on url source",
+			sources: []Source{{Type: SourceURL, Location: "https://example.com", Addresses: []string{"192.0.2.1"}}},
+			wantErr: true,
+		},
+		{
+			name:    "http settings on file source",
+			sources: []Source{{Type: SourceFile, Location: "/etc/lists/local.txt", HTTP: HTTP{BearerToken: "token"}}},
+			wantErr: true,
+		},
+		{
+			name:    "parser settings on static source",
+			sources: []Source{{Type: SourceStatic, Location: "192.0.2.1", Parser: Parser{Format: FormatCSV}}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid onError",
+			sources: []Source{{Type: SourceFile, Location: "/etc/lists/local.txt", SourceOptions: SourceOptions{OnError: "retry"}}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateSourceList(tt.sources)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("validateSourceList() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
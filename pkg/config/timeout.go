@@ -0,0 +1,45 @@
+package config
+
+import (
+	"fmt"
+	"time"
+)
+
+// Timeout values for entries that never expire.
+const (
+	TimeoutNone      = "none"
+	TimeoutPermanent = "permanent"
+)
+
+// ParseTimeout parses an entry timeout. "none" and "permanent" yield a
+// zero duration, meaning entries are added without a timeout. Timeouts
+// must be at least one second, the shortest RouterOS keeps an entry for.
+func ParseTimeout(s string) (time.Duration, error) {
+	switch s {
+	case TimeoutNone, TimeoutPermanent:
+		return 0, nil
+	}
+	d, err := ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < time.Second {
+		return 0, fmt.Errorf("invalid timeout %q: shorter than one second", s)
+	}
+	return d, nil
+}
+
+// sourceTimeout returns the timeout set on a source, or fallback if the
+// source has none.
+func sourceTimeout(timeout string, fallback time.Duration) (time.Duration, error) {
+	if timeout == "" {
+		return fallback, nil
+	}
+	return ParseTimeout(timeout)
+}
+
+// GetTimeout returns the timeout of entries from the source, or fallback
+// if none is set on the source.
+func (o SourceOptions) GetTimeout(fallback time.Duration) (time.Duration, error) {
+	return sourceTimeout(o.Timeout, fallback)
+}
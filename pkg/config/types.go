@@ -2,29 +2,92 @@ package config
 
 import (
 	"fmt"
+	"maps"
 	"regexp"
-	"strconv"
+	"slices"
+	"strings"
 	"time"
 )
 
+// Address families a list can be emitted for.
+const (
+	FamilyIPv4 = "ipv4"
+	FamilyIPv6 = "ipv6"
+	FamilyBoth = "both"
+)
+
+// Policies applied when a list source cannot be loaded.
+const (
+	OnErrorFail  = "fail"
+	OnErrorSkip  = "skip"
+	OnErrorStale = "stale"
+)
+
+// Strategies for replacing the contents of a list on the router.
+const (
+	UpdateReplace = "replace"
+	UpdateSwap    = "swap"
+)
+
 type Config struct {
 	Config ConfigDefaults  `yaml:"config"`
 	Lists  map[string]List `yaml:"lists"`
+
+	// Paths lists the files and directories the configuration was loaded
+	// from, so they can be watched for changes.
+	Paths []string `yaml:"-"`
+	// Secrets holds the values taken from environment variables and
+	// secret files, which are redacted from logs and API responses.
+	Secrets []string `yaml:"-"`
 }
 
 type ConfigDefaults struct {
-	Timeout       string `yaml:"timeout"`
-	CommentPrefix string `yaml:"commentPrefix"`
+	Timeout          string  `yaml:"timeout"`
+	CommentPrefix    string  `yaml:"commentPrefix"`
+	CommentTemplate  string  `yaml:"commentTemplate,omitempty"`
+	CommentMaxLength int     `yaml:"commentMaxLength,omitempty"`
+	Refresh          string  `yaml:"refresh,omitempty"`
+	CacheDir         string  `yaml:"cacheDir,omitempty"`
+	OnError          string  `yaml:"onError,omitempty"`
+	Resolver         string  `yaml:"resolver,omitempty"`
+	ASNData          ASNData `yaml:"asnData,omitempty"`
+	GeoData          GeoData `yaml:"geoData,omitempty"`
+	Fetch            Fetch   `yaml:"fetch,omitempty"`
+	Exclude          Exclude `yaml:"exclude,omitempty"`
+}
+
+// Exclude lists sources whose addresses are removed from generated lists.
+type Exclude struct {
+	URLs      []URLSource  `yaml:"urls,omitempty"`
+	Files     []FileSource `yaml:"files,omitempty"`
+	Addresses []string     `yaml:"addresses,omitempty"`
+	Countries []string     `yaml:"countries,omitempty"`
 }
 
 type List struct {
-	Timeout       string   `yaml:"timeout"`
-	CommentPrefix string   `yaml:"commentPrefix"`
-	URLs          []string `yaml:"urls,omitempty"`
-	Files         []string `yaml:"files,omitempty"`
-	Addresses     []string `yaml:"addresses,omitempty"`
+	Timeout          string         `yaml:"timeout"`
+	CommentPrefix    string         `yaml:"commentPrefix"`
+	CommentTemplate  string         `yaml:"commentTemplate,omitempty"`
+	CommentMaxLength int            `yaml:"commentMaxLength,omitempty"`
+	Refresh          string         `yaml:"refresh,omitempty"`
+	OnError          string         `yaml:"onError,omitempty"`
+	Fetch            Fetch          `yaml:"fetch,omitempty"`
+	URLs             []URLSource    `yaml:"urls,omitempty"`
+	Files            []FileSource   `yaml:"files,omitempty"`
+	Addresses        []AddressGroup `yaml:"addresses,omitempty"`
+	Sources          []Source       `yaml:"sources,omitempty"`
+	Domains          []string       `yaml:"domains,omitempty"`
+	ASNs             []string       `yaml:"asns,omitempty"`
+	Countries        []string       `yaml:"countries,omitempty"`
+	TTLTimeout       bool           `yaml:"ttlTimeout,omitempty"`
+	Aggregate        bool           `yaml:"aggregate,omitempty"`
+	Family           string         `yaml:"family,omitempty"`
+	UpdateStrategy   string         `yaml:"updateStrategy,omitempty"`
+	Exclude          Exclude        `yaml:"exclude,omitempty"`
 }
 
+// GetTimeout returns the timeout of the list's entries. A zero duration
+// means entries are permanent.
 func (l *List) GetTimeout(defaults ConfigDefaults) (time.Duration, error) {
 	timeoutStr := l.Timeout
 	if timeoutStr == "" {
@@ -34,61 +97,137 @@ func (l *List) GetTimeout(defaults ConfigDefaults) (time.Duration, error) {
 		return 0, fmt.Errorf("timeout not specified in list or defaults")
 	}
 
-	return parseDuration(timeoutStr)
+	return ParseTimeout(timeoutStr)
 }
 
-func (l *List) GetCommentPrefix(defaults ConfigDefaults) string {
-	if l.CommentPrefix != "" {
-		return l.CommentPrefix
+// UsesListTimeout reports whether any source of the list falls back on the
+// list timeout. A list whose sources all set their own timeout needs none.
+func (l *List) UsesListTimeout() bool {
+	if len(l.ASNs) > 0 || len(l.Countries) > 0 || (len(l.Domains) > 0 && !l.TTLTimeout) {
+		return true
 	}
-	return defaults.CommentPrefix
+	for _, u := range l.GetURLs() {
+		if u.Timeout == "" {
+			return true
+		}
+	}
+	for _, f := range l.GetFiles() {
+		if f.Timeout == "" {
+			return true
+		}
+	}
+	for _, g := range l.GetAddresses() {
+		if g.Timeout == "" {
+			return true
+		}
+	}
+	return false
 }
 
-func parseDuration(s string) (time.Duration, error) {
-	if s == "" {
-		return 0, fmt.Errorf("empty duration string")
+// GetURLs returns the enabled URL sources of the list, from both urls:
+// and sources:.
+func (l *List) GetURLs() []URLSource {
+	var urls []URLSource
+	for _, u := range l.URLs {
+		if u.IsEnabled() {
+			urls = append(urls, u)
+		}
 	}
+	for _, s := range l.Sources {
+		if s.Type == SourceURL && s.IsEnabled() {
+			urls = append(urls, s.urlSource())
+		}
+	}
+	return urls
+}
 
-	// Regular expression to match duration components
-	re := regexp.MustCompile(`^(?:(\d+)d)?(?:(\d+)h)?(?:(\d+)m)?(?:(\d+)s)?$`)
-	matches := re.FindStringSubmatch(s)
-
-	if matches == nil {
-		return 0, fmt.Errorf("invalid duration format: %s", s)
+// GetFiles returns the enabled file sources of the list, from both files:
+// and sources:.
+func (l *List) GetFiles() []FileSource {
+	var files []FileSource
+	for _, f := range l.Files {
+		if f.IsEnabled() {
+			files = append(files, f)
+		}
 	}
+	for _, s := range l.Sources {
+		if s.Type == SourceFile && s.IsEnabled() {
+			files = append(files, s.fileSource())
+		}
+	}
+	return files
+}
 
-	var duration time.Duration
+// GetAddresses returns the enabled static address groups of the list,
+// from both addresses: and sources:.
+func (l *List) GetAddresses() []AddressGroup {
+	var groups []AddressGroup
+	for _, g := range l.Addresses {
+		if g.IsEnabled() {
+			groups = append(groups, g)
+		}
+	}
+	for _, s := range l.Sources {
+		if s.Type == SourceStatic && s.IsEnabled() {
+			groups = append(groups, s.addressGroup())
+		}
+	}
+	return groups
+}
 
-	// Parse days
-	if matches[1] != "" {
-		days, _ := strconv.Atoi(matches[1])
-		duration += time.Duration(days) * 24 * time.Hour
+func (l *List) GetCommentPrefix(defaults ConfigDefaults) string {
+	if l.CommentPrefix != "" {
+		return l.CommentPrefix
 	}
+	return defaults.CommentPrefix
+}
 
-	// Parse hours
-	if matches[2] != "" {
-		hours, _ := strconv.Atoi(matches[2])
-		duration += time.Duration(hours) * time.Hour
+// GetRefresh returns the background refresh interval for the list's URL
+// sources. A zero duration means URLs are fetched on every request.
+func (l *List) GetRefresh(defaults ConfigDefaults) (time.Duration, error) {
+	if l.Refresh == "" {
+		return defaults.GetRefresh()
 	}
+	return ParseDuration(l.Refresh)
+}
 
-	// Parse minutes
-	if matches[3] != "" {
-		minutes, _ := strconv.Atoi(matches[3])
-		duration += time.Duration(minutes) * time.Minute
+// GetRefresh returns the global background refresh interval, or zero if
+// none is configured.
+func (d ConfigDefaults) GetRefresh() (time.Duration, error) {
+	if d.Refresh == "" {
+		return 0, nil
 	}
+	return ParseDuration(d.Refresh)
+}
 
-	// Parse seconds
-	if matches[4] != "" {
-		seconds, _ := strconv.Atoi(matches[4])
-		duration += time.Duration(seconds) * time.Second
+// GetOnError returns the policy applied when one of the list's sources
+// fails, defaulting to failing the whole list.
+func (l *List) GetOnError(defaults ConfigDefaults) string {
+	if l.OnError != "" {
+		return l.OnError
+	}
+	if defaults.OnError != "" {
+		return defaults.OnError
 	}
+	return OnErrorFail
+}
 
-	// Check if any valid duration component was found
-	if duration == 0 {
-		return 0, fmt.Errorf("invalid duration: %s (zero duration)", s)
+// GetUpdateStrategy returns how the list is replaced on the router,
+// defaulting to removing all entries before adding the new ones.
+func (l *List) GetUpdateStrategy() string {
+	if l.UpdateStrategy == "" {
+		return UpdateReplace
 	}
+	return l.UpdateStrategy
+}
 
-	return duration, nil
+// GetFamily returns the address family the list is emitted for,
+// defaulting to both IPv4 and IPv6.
+func (l *List) GetFamily() string {
+	if l.Family == "" {
+		return FamilyBoth
+	}
+	return l.Family
 }
 
 func ValidateConfig(cfg *Config) error {
@@ -98,24 +237,220 @@ func ValidateConfig(cfg *Config) error {
 
 	// Validate global timeout if specified
 	if cfg.Config.Timeout != "" {
-		if _, err := parseDuration(cfg.Config.Timeout); err != nil {
+		if _, err := ParseTimeout(cfg.Config.Timeout); err != nil {
 			return fmt.Errorf("invalid global timeout: %v", err)
 		}
 	}
 
+	// Validate global refresh interval if specified
+	if cfg.Config.Refresh != "" {
+		if _, err := ParseDuration(cfg.Config.Refresh); err != nil {
+			return fmt.Errorf("invalid global refresh: %v", err)
+		}
+	}
+
+	// Validate global failure policy if specified
+	if err := validateOnError(cfg.Config.OnError); err != nil {
+		return fmt.Errorf("invalid global onError: %v", err)
+	}
+
+	// Validate global comment settings
+	if err := validateComment(cfg.Config.CommentTemplate, cfg.Config.CommentMaxLength); err != nil {
+		return fmt.Errorf("invalid global comment settings: %v", err)
+	}
+
+	// Validate ASN data refresh interval if specified
+	if _, err := cfg.Config.ASNData.GetRefresh(); err != nil {
+		return fmt.Errorf("invalid asnData refresh: %v", err)
+	}
+
+	// Validate GeoIP data refresh interval if specified
+	if _, err := cfg.Config.GeoData.GetRefresh(); err != nil {
+		return fmt.Errorf("invalid geoData refresh: %v", err)
+	}
+
+	// Validate global exclusion sources
+	if err := validateSources(cfg.Config.Exclude.URLs, cfg.Config.Exclude.Files); err != nil {
+		return fmt.Errorf("invalid global exclude sources: %v", err)
+	}
+
+	// Validate global exclude addresses
+	if err := validateAddresses(cfg.Config.Exclude.Addresses); err != nil {
+		return fmt.Errorf("invalid global exclude addresses: %v", err)
+	}
+
+	// Validate global country exclusions
+	if err := validateCountries(cfg.Config.Exclude.Countries, cfg.Config.GeoData); err != nil {
+		return fmt.Errorf("invalid global exclude countries: %v", err)
+	}
+
+	// Validate global fetch options
+	if _, err := cfg.Config.GetFetch(); err != nil {
+		return fmt.Errorf("invalid global fetch options: %v", err)
+	}
+
+	// Script variables are named after their list, so names must not map
+	// to the same identifier
+	identifiers := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(cfg.Lists)) {
+		id := ScriptIdentifier(name)
+		if other, ok := identifiers[id]; ok {
+			return fmt.Errorf("lists %s and %s share the script variable name %s", other, name, id)
+		}
+		identifiers[id] = name
+	}
+
 	for name, list := range cfg.Lists {
+		// Validate the list name, which is written unquoted into scripts
+		if err := ValidateListName(name); err != nil {
+			return err
+		}
+
 		// Validate list timeout if specified
 		if list.Timeout != "" {
-			if _, err := parseDuration(list.Timeout); err != nil {
+			if _, err := ParseTimeout(list.Timeout); err != nil {
 				return fmt.Errorf("invalid timeout in list %s: %v", name, err)
 			}
 		}
 
+		// Validate list refresh interval if specified
+		if list.Refresh != "" {
+			if _, err := ParseDuration(list.Refresh); err != nil {
+				return fmt.Errorf("invalid refresh in list %s: %v", name, err)
+			}
+		}
+
+		// Validate list comment settings
+		if err := validateComment(list.CommentTemplate, list.CommentMaxLength); err != nil {
+			return fmt.Errorf("invalid comment settings in list %s: %v", name, err)
+		}
+
+		// Validate list failure policy if specified
+		if err := validateOnError(list.OnError); err != nil {
+			return fmt.Errorf("invalid onError in list %s: %v", name, err)
+		}
+
+		// Validate list fetch options
+		if _, err := list.Fetch.apply(FetchOptions{}); err != nil {
+			return fmt.Errorf("invalid fetch options in list %s: %v", name, err)
+		}
+
+		// Validate address family if specified
+		switch list.GetFamily() {
+		case FamilyIPv4, FamilyIPv6, FamilyBoth:
+		default:
+			return fmt.Errorf("invalid family in list %s: %s (expected ipv4, ipv6 or both)", name, list.Family)
+		}
+
+		// Validate update strategy if specified
+		switch list.GetUpdateStrategy() {
+		case UpdateReplace, UpdateSwap:
+		default:
+			return fmt.Errorf("invalid updateStrategy in list %s: %s (expected replace or swap)", name, list.UpdateStrategy)
+		}
+
+		// Validate AS numbers, which need the ASN data file
+		for _, asn := range list.ASNs {
+			if _, err := ParseASN(asn); err != nil {
+				return fmt.Errorf("invalid asns in list %s: %v", name, err)
+			}
+		}
+		if len(list.ASNs) > 0 && cfg.Config.ASNData.File == "" {
+			return fmt.Errorf("list %s uses asns but no asnData file is configured", name)
+		}
+
+		// Validate URL, file and static address sources
+		if err := validateSources(list.URLs, list.Files); err != nil {
+			return fmt.Errorf("invalid sources in list %s: %v", name, err)
+		}
+		if err := validateAddressGroups(list.Addresses); err != nil {
+			return fmt.Errorf("invalid addresses in list %s: %v", name, err)
+		}
+		if err := validateSourceList(list.Sources); err != nil {
+			return fmt.Errorf("invalid sources in list %s: %v", name, err)
+		}
+		if err := validateSources(list.Exclude.URLs, list.Exclude.Files); err != nil {
+			return fmt.Errorf("invalid exclude sources in list %s: %v", name, err)
+		}
+
+		// Validate exclude addresses and domains, which would otherwise
+		// fail every request for the list
+		if err := validateAddresses(list.Exclude.Addresses); err != nil {
+			return fmt.Errorf("invalid exclude addresses in list %s: %v", name, err)
+		}
+		for _, domain := range list.Domains {
+			if err := ValidateDomain(domain); err != nil {
+				return fmt.Errorf("invalid domains in list %s: %v", name, err)
+			}
+		}
+
+		// Validate country codes, which need the GeoIP data files
+		if err := validateCountries(list.Countries, cfg.Config.GeoData); err != nil {
+			return fmt.Errorf("invalid countries in list %s: %v", name, err)
+		}
+		if err := validateCountries(list.Exclude.Countries, cfg.Config.GeoData); err != nil {
+			return fmt.Errorf("invalid exclude countries in list %s: %v", name, err)
+		}
+
 		// Check if at least one source is defined
-		if len(list.URLs) == 0 && len(list.Files) == 0 && len(list.Addresses) == 0 {
-			return fmt.Errorf("list %s has no sources defined (urls, files, or addresses)", name)
+		if len(list.URLs) == 0 && len(list.Files) == 0 && len(list.Addresses) == 0 && len(list.Sources) == 0 &&
+			len(list.Domains) == 0 && len(list.ASNs) == 0 && len(list.Countries) == 0 {
+			return fmt.Errorf("list %s has no sources defined (urls, files, addresses, sources, domains, asns, or countries)", name)
 		}
 	}
 
 	return nil
 }
+
+// listNamePattern matches names that are safe to use unquoted as a
+// RouterOS address-list name.
+var listNamePattern = regexp.MustCompile(`^[A-Za-z0-9_][A-Za-z0-9_.-]*$`)
+
+// maxListNameLength leaves room for the "-staging" suffix of swap updates
+// within RouterOS's 63 character limit.
+const maxListNameLength = 55
+
+// ValidateListName reports whether name can be used as an address-list
+// name: letters, digits, "_", "." and "-", not starting with "." or "-".
+func ValidateListName(name string) error {
+	if !listNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid list name %q: only letters, digits, '_', '.' and '-' are allowed, starting with a letter, digit or '_'", name)
+	}
+	if len(name) > maxListNameLength {
+		return fmt.Errorf("invalid list name %q: longer than %d characters", name, maxListNameLength)
+	}
+	return nil
+}
+
+// ScriptIdentifier returns name with "." and "-" replaced by "_", for
+// naming the RouterOS global variables of a list. RouterOS reads those
+// characters in an unquoted variable name as operators.
+func ScriptIdentifier(name string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '.' || r == '-' {
+			return '_'
+		}
+		return r
+	}, name)
+}
+
+func validateCountries(codes []string, geo GeoData) error {
+	for _, code := range codes {
+		if _, err := ParseCountry(code); err != nil {
+			return err
+		}
+	}
+	if len(codes) > 0 && len(geo.Files) == 0 {
+		return fmt.Errorf("no geoData files configured")
+	}
+	return nil
+}
+
+func validateOnError(policy string) error {
+	switch policy {
+	case "", OnErrorFail, OnErrorSkip, OnErrorStale:
+		return nil
+	default:
+		return fmt.Errorf("%s (expected fail, skip or stale)", policy)
+	}
+}
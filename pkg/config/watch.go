@@ -0,0 +1,108 @@
+package config
+
+import (
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+// Watcher polls the files and directories a configuration was loaded from
+// and reports when any of them changes. Polling, unlike inotify, also
+// notices the symlink swaps Kubernetes uses to update mounted ConfigMaps,
+// and a directory's modification time reveals files added to or removed
+// from it.
+type Watcher struct {
+	interval time.Duration
+
+	mu    sync.Mutex
+	paths []string
+	state []fileState
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// fileState is what the watcher compares between polls. Missing paths
+// have the zero state.
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+func NewWatcher(paths []string, interval time.Duration) *Watcher {
+	w := &Watcher{interval: interval}
+	w.SetPaths(paths)
+	return w
+}
+
+// SetPaths replaces the watched paths, typically after a reload pulled in
+// different files. Their current state is taken as unchanged.
+func (w *Watcher) SetPaths(paths []string) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.paths = slices.Clone(paths)
+	w.state = statPaths(w.paths)
+}
+
+// Start calls onChange from a background goroutine whenever a watched
+// path changes. A zero interval disables watching.
+func (w *Watcher) Start(onChange func()) {
+	if w.interval <= 0 {
+		return
+	}
+
+	w.done = make(chan struct{})
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+
+		ticker := time.NewTicker(w.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-w.done:
+				return
+			case <-ticker.C:
+			}
+			if w.poll() {
+				onChange()
+			}
+		}
+	}()
+}
+
+// poll reports whether any watched path changed since the last poll.
+func (w *Watcher) poll() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	state := statPaths(w.paths)
+	if slices.Equal(state, w.state) {
+		return false
+	}
+	w.state = state
+	return true
+}
+
+// Stop terminates watching.
+func (w *Watcher) Stop() {
+	if w.done == nil {
+		return
+	}
+	close(w.done)
+	w.wg.Wait()
+	w.done = nil
+}
+
+func statPaths(paths []string) []fileState {
+	state := make([]fileState, len(paths))
+	for i, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			state[i] = fileState{modTime: info.ModTime(), size: info.Size()}
+		}
+	}
+	return state
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWatcher(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("lists: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	changed := make(chan struct{}, 1)
+	w := NewWatcher([]string{path}, 10*time.Millisecond)
+	w.Start(func() {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	})
+	defer w.Stop()
+
+	select {
+	case <-changed:
+		t.Fatal("Watcher reported a change before the file was modified")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	if err := os.WriteFile(path, []byte("lists:\n  test: {}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-changed:
+	case <-time.After(time.Second):
+		t.Fatal("Watcher did not report the modified file")
+	}
+}
@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// AddressKind classifies a single address token read from a source.
+type AddressKind int
+
+const (
+	KindIPv4Host AddressKind = iota
+	KindIPv4Prefix
+	KindIPv6Host
+	KindIPv6Prefix
+	KindRange
+)
+
+func (k AddressKind) String() string {
+	switch k {
+	case KindIPv4Host:
+		return "ipv4-host"
+	case KindIPv4Prefix:
+		return "ipv4-prefix"
+	case KindIPv6Host:
+		return "ipv6-host"
+	case KindIPv6Prefix:
+		return "ipv6-prefix"
+	case KindRange:
+		return "range"
+	default:
+		return "unknown"
+	}
+}
+
+// Address is a parsed and canonicalized address token. Ranges are
+// expanded into the minimal set of prefixes covering them.
+type Address struct {
+	Kind     AddressKind
+	Prefixes []netip.Prefix
+}
+
+// ParseAddress parses an IPv4/IPv6 host, a CIDR prefix or an
+// "<start>-<end>" range. Prefixes are masked to their network address,
+// so "10.0.0.5/8" becomes "10.0.0.0/8".
+func ParseAddress(s string) (Address, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Address{}, fmt.Errorf("empty address")
+	}
+
+	if start, end, ok := strings.Cut(s, "-"); ok {
+		from, err := parseAddr(start)
+		if err != nil {
+			return Address{}, err
+		}
+		to, err := parseAddr(end)
+		if err != nil {
+			return Address{}, err
+		}
+		if from.Is4() != to.Is4() {
+			return Address{}, fmt.Errorf("invalid range %q: mixed address families", s)
+		}
+		if from.Compare(to) > 0 {
+			return Address{}, fmt.Errorf("invalid range %q: start is after end", s)
+		}
+		return Address{Kind: KindRange, Prefixes: rangeToPrefixes(from, to)}, nil
+	}
+
+	if strings.Contains(s, "/") {
+		prefix, err := netip.ParsePrefix(s)
+		if err != nil {
+			return Address{}, fmt.Errorf("invalid prefix %q", s)
+		}
+		if prefix.Addr().Zone() != "" {
+			return Address{}, fmt.Errorf("invalid prefix %q: zones are not supported", s)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefix = prefix.Masked()
+		return Address{Kind: prefixKind(prefix), Prefixes: []netip.Prefix{prefix}}, nil
+	}
+
+	addr, err := parseAddr(s)
+	if err != nil {
+		return Address{}, err
+	}
+	prefix := netip.PrefixFrom(addr, addr.BitLen())
+	return Address{Kind: prefixKind(prefix), Prefixes: []netip.Prefix{prefix}}, nil
+}
+
+func prefixKind(p netip.Prefix) AddressKind {
+	switch {
+	case p.Addr().Is4() && p.IsSingleIP():
+		return KindIPv4Host
+	case p.Addr().Is4():
+		return KindIPv4Prefix
+	case p.IsSingleIP():
+		return KindIPv6Host
+	default:
+		return KindIPv6Prefix
+	}
+}
+
+func parseAddr(s string) (netip.Addr, error) {
+	s = strings.TrimSpace(s)
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, fmt.Errorf("invalid address %q", s)
+	}
+	if addr.Zone() != "" {
+		return netip.Addr{}, fmt.Errorf("invalid address %q: zones are not supported", s)
+	}
+	return addr.Unmap(), nil
+}
+
+// formatPrefix renders a prefix the way RouterOS expects it: single hosts
+// without a prefix length, networks in CIDR notation.
+func formatPrefix(p netip.Prefix) string {
+	if p.IsSingleIP() {
+		return p.Addr().String()
+	}
+	return p.String()
+}
+
+// lastAddr returns the highest address contained in p.
+func lastAddr(p netip.Prefix) netip.Addr {
+	b := p.Masked().Addr().AsSlice()
+	for i := p.Bits(); i < len(b)*8; i++ {
+		b[i/8] |= 0x80 >> (i % 8)
+	}
+	addr, _ := netip.AddrFromSlice(b)
+	return addr
+}
+
+// rangeToPrefixes returns the minimal set of prefixes covering the
+// inclusive range [from, to].
+func rangeToPrefixes(from, to netip.Addr) []netip.Prefix {
+	var prefixes []netip.Prefix
+	for {
+		bits := from.BitLen()
+		for bits > 0 {
+			wider := netip.PrefixFrom(from, bits-1)
+			if wider.Masked().Addr() != from || lastAddr(wider).Compare(to) > 0 {
+				break
+			}
+			bits--
+		}
+		prefix := netip.PrefixFrom(from, bits)
+		prefixes = append(prefixes, prefix)
+
+		last := lastAddr(prefix)
+		if last.Compare(to) >= 0 {
+			return prefixes
+		}
+		from = last.Next()
+	}
+}
@@ -0,0 +1,119 @@
+package generator
+
+import (
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		wantKind AddressKind
+		want     []string
+		wantErr  bool
+	}{
+		{
+			name:     "ipv4 host",
+			input:    "192.168.1.1",
+			wantKind: KindIPv4Host,
+			want:     []string{"192.168.1.1/32"},
+		},
+		{
+			name:     "ipv4 prefix",
+			input:    "10.0.0.0/24",
+			wantKind: KindIPv4Prefix,
+			want:     []string{"10.0.0.0/24"},
+		},
+		{
+			name:     "ipv4 prefix with host bits",
+			input:    "10.0.0.5/8",
+			wantKind: KindIPv4Prefix,
+			want:     []string{"10.0.0.0/8"},
+		},
+		{
+			name:     "ipv4 /32 prefix",
+			input:    "8.8.8.8/32",
+			wantKind: KindIPv4Host,
+			want:     []string{"8.8.8.8/32"},
+		},
+		{
+			name:     "ipv6 host",
+			input:    "2001:db8::1",
+			wantKind: KindIPv6Host,
+			want:     []string{"2001:db8::1/128"},
+		},
+		{
+			name:     "ipv6 prefix",
+			input:    "2001:db8::1/32",
+			wantKind: KindIPv6Prefix,
+			want:     []string{"2001:db8::/32"},
+		},
+		{
+			name:     "ipv4-mapped ipv6",
+			input:    "::ffff:1.2.3.4",
+			wantKind: KindIPv4Host,
+			want:     []string{"1.2.3.4/32"},
+		},
+		{
+			name:     "aligned range",
+			input:    "10.0.0.0-10.0.0.255",
+			wantKind: KindRange,
+			want:     []string{"10.0.0.0/24"},
+		},
+		{
+			name:     "unaligned range",
+			input:    "10.0.0.1-10.0.0.6",
+			wantKind: KindRange,
+			want:     []string{"10.0.0.1/32", "10.0.0.2/31", "10.0.0.4/31", "10.0.0.6/32"},
+		},
+		{
+			name:    "reversed range",
+			input:   "10.0.0.6-10.0.0.1",
+			wantErr: true,
+		},
+		{
+			name:    "mixed family range",
+			input:   "10.0.0.1-2001:db8::1",
+			wantErr: true,
+		},
+		{
+			name:    "hostname",
+			input:   "example.com",
+			wantErr: true,
+		},
+		{
+			name:    "invalid prefix length",
+			input:   "10.0.0.0/33",
+			wantErr: true,
+		},
+		{
+			name:    "zone",
+			input:   "fe80::1%eth0",
+			wantErr: true,
+		},
+		{
+			name:    "empty",
+			input:   "",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseAddress(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParseAddress() error = %v, wantErr %v", err, tt.wantErr)
+				return
+			}
+			if tt.wantErr {
+				return
+			}
+			if got.Kind != tt.wantKind {
+				t.Errorf("ParseAddress() kind = %v, want %v", got.Kind, tt.wantKind)
+			}
+			if !stringSliceEqual(prefixStrings(got.Prefixes), tt.want) {
+				t.Errorf("ParseAddress() = %v, want %v", got.Prefixes, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"math"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// aggregateEntries removes duplicate entries and entries already covered by
+// a larger prefix in the list. Of duplicate entries the one living longest
+// wins, the first one on a tie, and a covered entry is only removed when
+// the covering entry lives at least as long, so permanent entries are never
+// replaced by expiring ones. When merge is set, adjacent sibling prefixes
+// sharing the same timeout are also merged into their parent, producing the
+// minimal covering set. Merged prefixes keep the comment of their lower
+// half.
+func aggregateEntries(entries []Entry, merge bool) []Entry {
+	unique := make([]Entry, 0, len(entries))
+	index := make(map[netip.Prefix]int, len(entries))
+	for _, entry := range entries {
+		i, ok := index[entry.Prefix]
+		if !ok {
+			index[entry.Prefix] = len(unique)
+			unique = append(unique, entry)
+		} else if entryLifetime(entry) > entryLifetime(unique[i]) {
+			unique[i] = entry
+		}
+	}
+	sort.SliceStable(unique, func(i, j int) bool {
+		return comparePrefix(unique[i].Prefix, unique[j].Prefix) < 0
+	})
+
+	// covering holds the kept entries containing the current one, outermost
+	// first. Each outlives the ones before it, so the innermost decides.
+	result := make([]Entry, 0, len(unique))
+	var covering []Entry
+	for _, entry := range unique {
+		for len(covering) > 0 && !covers(covering[len(covering)-1].Prefix, entry.Prefix) {
+			covering = covering[:len(covering)-1]
+		}
+		if n := len(covering); n > 0 && entryLifetime(entry) <= entryLifetime(covering[n-1]) {
+			continue
+		}
+		result = append(result, entry)
+		covering = append(covering, entry)
+	}
+
+	if !merge {
+		return result
+	}
+	merged := make([]Entry, 0, len(result))
+	for _, entry := range result {
+		merged = append(merged, entry)
+
+		for len(merged) >= 2 {
+			lo, hi := merged[len(merged)-2], merged[len(merged)-1]
+			parent, ok := mergeSiblings(lo.Prefix, hi.Prefix)
+			if !ok || lo.Timeout != hi.Timeout {
+				break
+			}
+			lo.Prefix = parent
+			merged = append(merged[:len(merged)-2], lo)
+		}
+	}
+
+	return merged
+}
+
+// entryLifetime returns how long an entry stays on the router. Permanent
+// entries outlive any timeout.
+func entryLifetime(e Entry) time.Duration {
+	if e.Timeout == "" {
+		return math.MaxInt64
+	}
+	d, err := config.ParseDuration(e.Timeout)
+	if err != nil {
+		return 0
+	}
+	return d
+}
+
+// comparePrefix orders prefixes by address family, then network address,
+// then prefix length so that a covering prefix sorts before the prefixes
+// it contains.
+func comparePrefix(a, b netip.Prefix) int {
+	if c := a.Addr().Compare(b.Addr()); c != 0 {
+		return c
+	}
+	return a.Bits() - b.Bits()
+}
+
+// covers reports whether outer contains every address of inner.
+func covers(outer, inner netip.Prefix) bool {
+	return outer.Addr().BitLen() == inner.Addr().BitLen() &&
+		outer.Bits() <= inner.Bits() &&
+		outer.Contains(inner.Addr())
+}
+
+// mergeSiblings returns the parent of a and b if they are the two halves
+// of the same prefix.
+func mergeSiblings(a, b netip.Prefix) (netip.Prefix, bool) {
+	if a.Bits() != b.Bits() || a.Bits() == 0 || a == b {
+		return netip.Prefix{}, false
+	}
+	parent := netip.PrefixFrom(a.Addr(), a.Bits()-1).Masked()
+	if parent.Addr() != a.Addr() || !parent.Contains(b.Addr()) {
+		return netip.Prefix{}, false
+	}
+	return parent, true
+}
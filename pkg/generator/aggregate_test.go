@@ -0,0 +1,145 @@
+package generator
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestAggregateEntries(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []string
+		merge bool
+		want  []string
+	}{
+		{
+			name:  "duplicates",
+			input: []string{"192.168.1.1/32", "10.0.0.0/24", "192.168.1.1/32"},
+			want:  []string{"10.0.0.0/24", "192.168.1.1/32"},
+		},
+		{
+			name:  "covered by larger prefix",
+			input: []string{"10.0.0.5/32", "10.0.0.0/24", "10.0.0.128/25", "10.0.1.1/32"},
+			want:  []string{"10.0.0.0/24", "10.0.1.1/32"},
+		},
+		{
+			name:  "adjacent without merge",
+			input: []string{"10.0.0.0/25", "10.0.0.128/25"},
+			want:  []string{"10.0.0.0/25", "10.0.0.128/25"},
+		},
+		{
+			name:  "adjacent with merge",
+			input: []string{"10.0.0.128/25", "10.0.0.0/25"},
+			merge: true,
+			want:  []string{"10.0.0.0/24"},
+		},
+		{
+			name:  "cascading merge",
+			input: []string{"10.0.0.0/32", "10.0.0.1/32", "10.0.0.2/32", "10.0.0.3/32"},
+			merge: true,
+			want:  []string{"10.0.0.0/30"},
+		},
+		{
+			name:  "non-sibling neighbours",
+			input: []string{"10.0.0.1/32", "10.0.0.2/32"},
+			merge: true,
+			want:  []string{"10.0.0.1/32", "10.0.0.2/32"},
+		},
+		{
+			name:  "mixed families",
+			input: []string{"2001:db8::/33", "10.0.0.0/8", "2001:db8:8000::/33", "2001:db8::1/128"},
+			merge: true,
+			want:  []string{"10.0.0.0/8", "2001:db8::/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []Entry
+			for _, s := range tt.input {
+				entries = append(entries, Entry{Prefix: netip.MustParsePrefix(s)})
+			}
+
+			got := aggregateEntries(entries, tt.merge)
+
+			var prefixes []netip.Prefix
+			for _, e := range got {
+				prefixes = append(prefixes, e.Prefix)
+			}
+			if !stringSliceEqual(prefixStrings(prefixes), tt.want) {
+				t.Errorf("aggregateEntries() = %v, want %v", prefixes, tt.want)
+			}
+		})
+	}
+}
+
+func TestAggregateEntries_KeepsFirstComment(t *testing.T) {
+	entries := []Entry{
+		{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Comment: "first"},
+		{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Comment: "second"},
+	}
+
+	got := aggregateEntries(entries, false)
+	if len(got) != 1 || got[0].Comment != "first" {
+		t.Errorf("aggregateEntries() = %v, want single entry with comment %q", got, "first")
+	}
+}
+
+func TestAggregateEntries_KeepsLongestTimeout(t *testing.T) {
+	tests := []struct {
+		name  string
+		input []Entry
+		want  []Entry
+	}{
+		{
+			name: "duplicate permanent entry",
+			input: []Entry{
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Timeout: "01:00:00", Comment: "feed"},
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Comment: "static"},
+			},
+			want: []Entry{{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Comment: "static"}},
+		},
+		{
+			name: "duplicate longer timeout",
+			input: []Entry{
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Timeout: "02:00:00"},
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Timeout: "1d"},
+			},
+			want: []Entry{{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Timeout: "1d"}},
+		},
+		{
+			name: "permanent entry inside expiring prefix",
+			input: []Entry{
+				{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Timeout: "01:00:00"},
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32")},
+				{Prefix: netip.MustParsePrefix("192.0.2.2/32"), Timeout: "00:30:00"},
+			},
+			want: []Entry{
+				{Prefix: netip.MustParsePrefix("192.0.2.0/24"), Timeout: "01:00:00"},
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32")},
+			},
+		},
+		{
+			name: "expiring entry inside permanent prefix",
+			input: []Entry{
+				{Prefix: netip.MustParsePrefix("192.0.2.1/32"), Timeout: "01:00:00"},
+				{Prefix: netip.MustParsePrefix("192.0.2.0/24")},
+			},
+			want: []Entry{{Prefix: netip.MustParsePrefix("192.0.2.0/24")}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := aggregateEntries(tt.input, true)
+			if len(got) != len(tt.want) {
+				t.Fatalf("aggregateEntries() = %v, want %v", got, tt.want)
+			}
+			for i := range tt.want {
+				if got[i] != tt.want[i] {
+					t.Errorf("aggregateEntries()[%d] = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
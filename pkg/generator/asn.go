@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// newASNTable returns a table of the prefixes originated by each AS, read
+// from a local prefix-to-ASN data file such as a table derived from an MRT
+// RIB dump or the bgp.tools table.
+func newASNTable(path string) *prefixTable[uint32] {
+	var paths []string
+	if path != "" {
+		paths = []string{path}
+	}
+	return newPrefixTable("asnData", paths, readASNFiles)
+}
+
+func readASNFiles(paths []string) (map[uint32][]netip.Prefix, error) {
+	table := make(map[uint32][]netip.Prefix)
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		invalid, err := readASNTable(file, table)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+		if invalid > 0 {
+			log.Printf("Skipped %d invalid lines in %s", invalid, path)
+		}
+	}
+	return table, nil
+}
+
+// asnRecord is a line of the bgp.tools table.jsonl format.
+type asnRecord struct {
+	CIDR string `json:"CIDR"`
+	ASN  uint32 `json:"ASN"`
+}
+
+// readASNTable parses a prefix-to-ASN table into table. Each line holds a
+// prefix and its origin AS, either as JSON ({"CIDR": "...", "ASN": 13335})
+// or as two fields separated by whitespace or a comma ("1.1.1.0/24 13335").
+// Lines starting with "#" or ";" are comments. It returns the number of
+// lines that could not be parsed.
+func readASNTable(r io.Reader, table map[uint32][]netip.Prefix) (int, error) {
+	invalid := 0
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+
+		var prefix, asn string
+		if strings.HasPrefix(line, "{") {
+			var record asnRecord
+			if err := json.Unmarshal([]byte(line), &record); err != nil {
+				invalid++
+				continue
+			}
+			prefix, asn = record.CIDR, fmt.Sprint(record.ASN)
+		} else {
+			fields := strings.FieldsFunc(line, func(r rune) bool {
+				return r == ',' || r == ' ' || r == '\t'
+			})
+			if len(fields) < 2 {
+				invalid++
+				continue
+			}
+			prefix, asn = fields[0], fields[1]
+		}
+
+		number, err := config.ParseASN(asn)
+		if err != nil {
+			invalid++
+			continue
+		}
+		parsed, err := ParseAddress(prefix)
+		if err != nil {
+			invalid++
+			continue
+		}
+		table[number] = append(table[number], parsed.Prefixes...)
+	}
+
+	return invalid, scanner.Err()
+}
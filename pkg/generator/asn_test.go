@@ -0,0 +1,120 @@
+package generator
+
+import (
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadASNTable(t *testing.T) {
+	input := `; IP-ASN32-DAT file
+# comment
+1.1.1.0/24	13335
+1.0.0.0/24 AS13335
+8.8.8.0/24,15169
+{"CIDR":"2606:4700::/32","ASN":13335,"Hits":100}
+not-a-prefix 1
+9.9.9.0/24 ASX
+`
+	table := make(map[uint32][]netip.Prefix)
+	invalid, err := readASNTable(strings.NewReader(input), table)
+	if err != nil {
+		t.Fatalf("readASNTable() error = %v", err)
+	}
+	if invalid != 2 {
+		t.Errorf("readASNTable() invalid = %d, want 2", invalid)
+	}
+
+	want := map[uint32][]string{
+		13335: {"1.1.1.0/24", "1.0.0.0/24", "2606:4700::/32"},
+		15169: {"8.8.8.0/24"},
+	}
+	for asn, prefixes := range want {
+		if got := prefixStrings(table[asn]); !stringSliceEqual(got, prefixes) {
+			t.Errorf("readASNTable() AS%d = %v, want %v", asn, got, prefixes)
+		}
+	}
+}
+
+func TestPrefixTable_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24 64500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	table := newASNTable(path)
+	prefixes, err := table.lookup(64500)
+	if err != nil {
+		t.Fatalf("lookup() error = %v", err)
+	}
+	if got := prefixStrings(prefixes); !stringSliceEqual(got, []string{"192.0.2.0/24"}) {
+		t.Errorf("lookup() = %v", got)
+	}
+
+	// A changed file is picked up on reload
+	if err := os.WriteFile(path, []byte("198.51.100.0/24 64500\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	future := time.Now().Add(time.Hour)
+	if err := os.Chtimes(path, future, future); err != nil {
+		t.Fatal(err)
+	}
+	if err := table.reload(); err != nil {
+		t.Fatalf("reload() error = %v", err)
+	}
+	prefixes, _ = table.lookup(64500)
+	if got := prefixStrings(prefixes); !stringSliceEqual(got, []string{"198.51.100.0/24"}) {
+		t.Errorf("lookup() after reload = %v", got)
+	}
+
+	// A missing file keeps the previous table
+	os.Remove(path)
+	if err := table.reload(); err == nil {
+		t.Errorf("reload() expected error for missing file")
+	}
+	prefixes, _ = table.lookup(64500)
+	if len(prefixes) != 1 {
+		t.Errorf("lookup() after failed reload = %v, want previous table", prefixes)
+	}
+}
+
+func TestGenerator_GenerateListASNs(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "asn.txt")
+	data := "192.0.2.0/24 64500\n2001:db8::/32 64500\n198.51.100.0/24 64501\n"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+			ASNData:       config.ASNData{File: path},
+		},
+		Lists: map[string]config.List{
+			"test": {ASNs: []string{"AS64500"}},
+		},
+	}
+
+	g := NewGenerator(cfg)
+	script, err := g.GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	for _, line := range []string{
+		`$testAddIP "192.0.2.0/24" "test/asn/AS64500" "1d"`,
+		`$testAddIPv6 "2001:db8::/32" "test/asn/AS64500" "1d"`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+	if strings.Contains(script, "198.51.100.0/24") {
+		t.Errorf("GenerateList() script contains prefix of another AS")
+	}
+}
@@ -0,0 +1,286 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"mk-addrlist-generator/pkg/config"
+	"sync"
+	"time"
+)
+
+// sourceCache keeps the last successful result of every URL source so
+// that list generation can be served from memory while sources are
+// refreshed in the background. When a directory is configured, fetched
+// documents are persisted there and reloaded after a restart.
+type sourceCache struct {
+	fetch fetchFunc
+	dir   string
+
+	mu      sync.Mutex
+	sources map[string]*cachedSource
+
+	// cancel stops the background refreshes and interrupts their fetches
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// fetchFunc downloads a URL source, handing back prev when it is unchanged.
+type fetchFunc func(ctx context.Context, src urlSource, prev *document) (*document, error)
+
+// urlSource describes how a URL source is fetched, parsed and refreshed.
+type urlSource struct {
+	URL     string
+	Refresh time.Duration
+	Fetch   config.FetchOptions
+	Parser  config.Parser
+	HTTP    config.HTTP
+}
+
+// key identifies the cached document of the source. Sources with the same
+// URL but different request settings, such as credentials or size limits,
+// are cached separately so they never share a response or its validators.
+func (us urlSource) key() string {
+	settings, _ := json.Marshal(struct {
+		HTTP  config.HTTP
+		Fetch config.FetchOptions
+	}{us.HTTP, us.Fetch})
+	sum := sha256.Sum256(settings)
+	return us.URL + "#" + hex.EncodeToString(sum[:8])
+}
+
+// forURL fills in the URL and the per-source settings of u, keeping the
+// refresh and fetch options shared by the list.
+func (us urlSource) forURL(u config.URLSource) urlSource {
+	us.URL = u.URL
+	us.Parser = u.Parser
+	us.HTTP = u.HTTP
+	return us
+}
+
+type cachedSource struct {
+	// fetching serializes fetches of the same source. It is held for the
+	// whole download, while mu only guards the fields below and is never
+	// held across network calls.
+	fetching sync.Mutex
+
+	mu      sync.Mutex
+	loaded  bool // on-disk copy has been looked up
+	doc     *document
+	valid   bool                          // doc is a good copy
+	results map[config.Parser]ParseResult // doc parsed by each parser used
+	lastErr error                         // outcome of the latest fetch
+}
+
+// result returns the last good copy parsed with parser.
+func (src *cachedSource) result(url string, parser config.Parser) (ParseResult, error) {
+	if result, ok := src.results[parser]; ok {
+		return result, nil
+	}
+	result, err := parseSource(bytes.NewReader(src.doc.Body), url, parser)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	src.results[parser] = result
+	return result, nil
+}
+
+func newSourceCache(fetch fetchFunc, dir string) *sourceCache {
+	return &sourceCache{
+		fetch:   fetch,
+		dir:     dir,
+		sources: make(map[string]*cachedSource),
+	}
+}
+
+func (c *sourceCache) source(us urlSource) *cachedSource {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := us.key()
+	src, ok := c.sources[key]
+	if !ok {
+		src = &cachedSource{}
+		c.sources[key] = src
+	}
+	return src
+}
+
+// get returns the addresses of a URL source. Sources refreshed in the
+// background (Refresh > 0) are served from memory or disk once they have
+// been fetched, without waiting for a refresh in progress; other sources
+// are fetched on every call.
+func (c *sourceCache) get(us urlSource) (ParseResult, error) {
+	src := c.source(us)
+
+	if us.Refresh > 0 {
+		if result, ok, err := c.cached(src, us); ok {
+			return result, err
+		}
+	}
+
+	src.fetching.Lock()
+	defer src.fetching.Unlock()
+
+	// Another request may have fetched the source while this one waited
+	if us.Refresh > 0 {
+		if result, ok, err := c.cached(src, us); ok {
+			return result, err
+		}
+	}
+	return c.update(context.Background(), src, us)
+}
+
+// cached returns the last good copy of a URL source parsed with the
+// source's parser, if there is one.
+func (c *sourceCache) cached(src *cachedSource, us urlSource) (ParseResult, bool, error) {
+	src.mu.Lock()
+	defer src.mu.Unlock()
+
+	c.load(src, us)
+	if !src.valid {
+		return ParseResult{}, false, nil
+	}
+	result, err := src.result(us.URL, us.Parser)
+	return result, true, err
+}
+
+// stale returns the last good copy of a URL source, if any, without
+// fetching it.
+func (c *sourceCache) stale(us urlSource) (ParseResult, bool) {
+	result, ok, err := c.cached(c.source(us), us)
+	return result, ok && err == nil
+}
+
+// lastError returns the error of the latest fetch of a URL source, or nil
+// if it succeeded. Sources refreshed in the background are served their
+// last good copy when a refresh fails, so this tells that the copy is stale.
+func (c *sourceCache) lastError(us urlSource) error {
+	src := c.source(us)
+
+	src.mu.Lock()
+	defer src.mu.Unlock()
+	return src.lastErr
+}
+
+// refresh fetches a URL source again, keeping the last good copy on failure.
+func (c *sourceCache) refresh(ctx context.Context, us urlSource) error {
+	src := c.source(us)
+
+	src.fetching.Lock()
+	defer src.fetching.Unlock()
+
+	_, err := c.update(ctx, src, us)
+	return err
+}
+
+// load restores the persisted copy of a URL source the first time it is
+// needed.
+func (c *sourceCache) load(src *cachedSource, us urlSource) {
+	if src.loaded || c.dir == "" {
+		return
+	}
+	src.loaded = true
+
+	doc, err := loadDocument(c.dir, us.key())
+	if err != nil {
+		log.Printf("Error loading cached copy of %s: %v", us.URL, err)
+		return
+	}
+	if doc == nil {
+		return
+	}
+
+	src.doc = doc
+	src.results = make(map[config.Parser]ParseResult)
+	src.valid = true
+}
+
+// update fetches a URL source and swaps in the new copy. The caller holds
+// src.fetching; src.mu is only taken to read and replace the cached copy,
+// so requests served from it never wait for the upstream.
+func (c *sourceCache) update(ctx context.Context, src *cachedSource, us urlSource) (ParseResult, error) {
+	url := us.URL
+
+	src.mu.Lock()
+	c.load(src, us)
+	prev := src.doc
+	src.mu.Unlock()
+
+	doc, err := c.fetch(ctx, us, prev)
+	var result ParseResult
+	if err == nil && doc != prev {
+		result, err = parseSource(bytes.NewReader(doc.Body), url, us.Parser)
+	}
+
+	src.mu.Lock()
+	src.lastErr = err
+	if err != nil {
+		src.mu.Unlock()
+		return ParseResult{}, err
+	}
+	doc.FetchedAt = time.Now()
+	// A not-modified response hands back the previous document
+	if doc == prev {
+		defer src.mu.Unlock()
+		return src.result(url, us.Parser)
+	}
+	doc.Key = us.key()
+	src.doc = doc
+	src.results = map[config.Parser]ParseResult{us.Parser: result}
+	src.valid = true
+	src.mu.Unlock()
+
+	if c.dir != "" {
+		if err := saveDocument(c.dir, doc); err != nil {
+			log.Printf("Error persisting %s: %v", url, err)
+		}
+	}
+
+	return result, nil
+}
+
+// start launches a background refresh goroutine for every URL source.
+// Each source is fetched immediately and then again after every interval.
+func (c *sourceCache) start(sources []urlSource) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c.cancel = cancel
+
+	for _, us := range sources {
+		c.wg.Add(1)
+		go c.refreshLoop(ctx, us)
+	}
+}
+
+func (c *sourceCache) refreshLoop(ctx context.Context, us urlSource) {
+	defer c.wg.Done()
+
+	ticker := time.NewTicker(us.Refresh)
+	defer ticker.Stop()
+
+	for {
+		if err := c.refresh(ctx, us); err != nil && ctx.Err() == nil {
+			log.Printf("Error refreshing %s, serving last good copy: %v", us.URL, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stop terminates all background refresh goroutines, cancelling fetches
+// in progress.
+func (c *sourceCache) stop() {
+	if c.cancel == nil {
+		return
+	}
+	c.cancel()
+	c.wg.Wait()
+	c.cancel = nil
+}
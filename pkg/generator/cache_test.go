@@ -0,0 +1,203 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSourceCache_Get(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+
+	g := NewGenerator(&config.Config{})
+
+	// Without refresh interval every call goes upstream
+	for i := 0; i < 2; i++ {
+		if _, err := g.cache.get(urlSource{URL: srv.URL}); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("get() upstream hits = %d, want 2", got)
+	}
+
+	// With refresh interval the cached copy is served
+	for i := 0; i < 2; i++ {
+		if _, err := g.cache.get(urlSource{URL: srv.URL, Refresh: time.Hour}); err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	}
+	if got := hits.Load(); got != 2 {
+		t.Errorf("get() upstream hits = %d, want 2", got)
+	}
+}
+
+func TestSourceCache_ServesLastGoodCopy(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+
+	g := NewGenerator(&config.Config{})
+	url := srv.URL
+	if _, err := g.cache.get(urlSource{URL: url, Refresh: time.Hour}); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+
+	srv.Close()
+	if err := g.cache.refresh(context.Background(), urlSource{URL: url}); err == nil {
+		t.Fatal("refresh() expected error for unreachable upstream")
+	}
+
+	result, err := g.cache.get(urlSource{URL: url, Refresh: time.Hour})
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if len(result.Prefixes) != 1 || result.Prefixes[0].String() != "192.168.1.1/32" {
+		t.Errorf("get() = %v, want last good copy", result.Prefixes)
+	}
+}
+
+func TestSourceCache_BackgroundRefresh(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+
+	g := NewGenerator(&config.Config{})
+	g.cache.start([]urlSource{{URL: srv.URL, Refresh: 10 * time.Millisecond}})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for hits.Load() < 3 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	g.cache.stop()
+
+	if got := hits.Load(); got < 3 {
+		t.Errorf("background refresh upstream hits = %d, want at least 3", got)
+	}
+}
+
+func TestSourceCache_GetDuringRefresh(t *testing.T) {
+	var slow atomic.Bool
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			<-release
+		}
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	g := NewGenerator(&config.Config{})
+	us := urlSource{URL: srv.URL, Refresh: time.Hour}
+	if _, err := g.cache.get(us); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+
+	// A refresh stuck on the upstream must not hold up the cached copy
+	slow.Store(true)
+	go g.cache.refresh(context.Background(), us)
+	time.Sleep(50 * time.Millisecond)
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := g.cache.get(us)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("get() waited for the refresh in progress")
+	}
+}
+
+func TestSourceCache_SeparatesCredentials(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"`+r.Header.Get("Authorization")+`"`)
+		if r.Header.Get("Authorization") == "Bearer a" {
+			fmt.Fprintln(w, "192.0.2.1")
+		} else {
+			fmt.Fprintln(w, "198.51.100.1")
+		}
+	}))
+	defer srv.Close()
+
+	g := NewGenerator(&config.Config{Config: config.ConfigDefaults{CacheDir: t.TempDir()}})
+	tokens := map[string]string{"a": "192.0.2.1/32", "b": "198.51.100.1/32"}
+	for _, token := range []string{"a", "b"} {
+		us := urlSource{URL: srv.URL, Refresh: time.Hour, HTTP: config.HTTP{BearerToken: token}}
+		result, err := g.cache.get(us)
+		if err != nil {
+			t.Fatalf("get() error = %v", err)
+		}
+		if got := prefixStrings(result.Prefixes); !stringSliceEqual(got, []string{tokens[token]}) {
+			t.Errorf("get() with token %s = %v, want %s", token, got, tokens[token])
+		}
+
+		doc, err := loadDocument(g.cache.dir, us.key())
+		if err != nil || doc == nil || doc.ETag != `"Bearer `+token+`"` {
+			t.Errorf("loadDocument() with token %s = %+v, %v, want its own validators", token, doc, err)
+		}
+	}
+}
+
+func TestGenerator_GenerateListReportsFailedRefresh(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	url := srv.URL
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", Refresh: "1h", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {URLs: []config.URLSource{{URL: url}}},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	report, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if len(report.SourceErrors) != 0 {
+		t.Errorf("GenerateListReport() source errors = %v, want none", report.SourceErrors)
+	}
+
+	// A failed background refresh keeps serving the last good copy, but
+	// reports it as stale
+	srv.Close()
+	us, err := g.listURLSource(cfg.Lists["test"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := g.cache.refresh(context.Background(), us.forURL(cfg.Lists["test"].URLs[0])); err == nil {
+		t.Fatal("refresh() expected error for unreachable upstream")
+	}
+	report, err = g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if len(report.SourceErrors) != 1 || report.SourceErrors[0].Action != ActionStale {
+		t.Errorf("GenerateListReport() source errors = %v, want one stale source", report.SourceErrors)
+	}
+	if !strings.Contains(report.Script, `$testAddIP "192.168.1.1"`) {
+		t.Errorf("GenerateListReport() script does not contain the last good copy:\n%s", report.Script)
+	}
+}
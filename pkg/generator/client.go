@@ -0,0 +1,91 @@
+package generator
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+)
+
+// clientCache holds one HTTP client per set of transport settings, so
+// sources sharing them also share connections.
+type clientCache struct {
+	mu      sync.Mutex
+	clients map[config.TLS]*http.Client
+}
+
+// get returns the client for settings, creating it on first use. Client
+// certificates and CA bundles are read at that point.
+func (c *clientCache) get(settings config.TLS) (*http.Client, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if client, ok := c.clients[settings]; ok {
+		return client, nil
+	}
+
+	client := &http.Client{}
+	if settings != (config.TLS{}) {
+		transport, err := newTransport(settings)
+		if err != nil {
+			return nil, err
+		}
+		client.Transport = transport
+	}
+
+	if c.clients == nil {
+		c.clients = make(map[config.TLS]*http.Client)
+	}
+	c.clients[settings] = client
+	return client, nil
+}
+
+// reset drops all clients, so that certificate files are read again.
+func (c *clientCache) reset() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, client := range c.clients {
+		client.CloseIdleConnections()
+	}
+	c.clients = nil
+}
+
+func newTransport(settings config.TLS) (*http.Transport, error) {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: settings.InsecureSkipVerify}
+
+	if settings.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(settings.ClientCert, settings.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("error loading client certificate: %v", err)
+		}
+		transport.TLSClientConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	if settings.CABundle != "" {
+		pem, err := os.ReadFile(settings.CABundle)
+		if err != nil {
+			return nil, fmt.Errorf("error reading CA bundle: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA bundle %s", settings.CABundle)
+		}
+		transport.TLSClientConfig.RootCAs = pool
+	}
+
+	if settings.Proxy != "" {
+		proxy, err := url.Parse(settings.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy URL: %v", err)
+		}
+		transport.Proxy = http.ProxyURL(proxy)
+	}
+
+	return transport, nil
+}
@@ -0,0 +1,97 @@
+package generator
+
+import (
+	"bytes"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"strconv"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+// CommentData is the data entry comment templates are executed with.
+type CommentData struct {
+	// Prefix is the comment prefix of the list.
+	Prefix string
+	// SourceType is the kind of source the entry comes from: url, file,
+	// dns, asn, country or static.
+	SourceType string
+	// SourceName is the name given to the source, or a short default such
+	// as "external", "file", "dns/example.com" or "asn/AS13335".
+	SourceName string
+	// Source is the URL, path, domain, AS number or country code the entry
+	// comes from.
+	Source string
+	// Comment is the comment the source gave the entry, or else the
+	// comment configured on the source, if any.
+	Comment string
+	// Score is the score the source gave the entry, if any.
+	Score string
+}
+
+// commenter renders entry comments with the template of a list.
+type commenter struct {
+	tmpl      *template.Template
+	maxLength int
+	prefix    string
+}
+
+func newCommenter(list config.List, defaults config.ConfigDefaults) (*commenter, error) {
+	tmpl, err := template.New("comment").Parse(list.GetCommentTemplate(defaults))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing comment template: %v", err)
+	}
+	return &commenter{
+		tmpl:      tmpl,
+		maxLength: list.GetCommentMaxLength(defaults),
+		prefix:    list.GetCommentPrefix(defaults),
+	}, nil
+}
+
+// render executes the template for an entry. The comment is flattened to
+// a single line and truncated to the maximum length.
+func (c *commenter) render(data CommentData) (string, error) {
+	data.Prefix = c.prefix
+
+	var buf bytes.Buffer
+	if err := c.tmpl.Execute(&buf, data); err != nil {
+		return "", fmt.Errorf("error executing comment template: %v", err)
+	}
+	return truncate(flatten(buf.String()), c.maxLength), nil
+}
+
+// sourceData returns the comment data of an entry read from a URL or file,
+// adding what the source says about the entry to the data of the source.
+func sourceData(data CommentData, result ParseResult, prefix netip.Prefix) CommentData {
+	if meta, ok := result.Metadata[prefix]; ok {
+		if meta.Comment != "" {
+			data.Comment = meta.Comment
+		}
+		if meta.Scored {
+			data.Score = strconv.FormatFloat(meta.Score, 'f', -1, 64)
+		}
+	}
+	return data
+}
+
+// flatten replaces control characters such as line breaks with spaces and
+// collapses runs of whitespace.
+func flatten(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+}
+
+// truncate shortens s to at most n characters.
+func truncate(s string, n int) string {
+	if n <= 0 {
+		return s
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
@@ -0,0 +1,112 @@
+package generator
+
+import (
+	"mk-addrlist-generator/pkg/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCommenter_Render(t *testing.T) {
+	tests := []struct {
+		name      string
+		template  string
+		maxLength int
+		data      CommentData
+		want      string
+	}{
+		{
+			name: "default",
+			data: CommentData{SourceType: "url", SourceName: "external"},
+			want: "test/external",
+		},
+		{
+			name: "default with score and comment",
+			data: CommentData{SourceType: "file", SourceName: "file", Score: "7", Comment: "SBL256894"},
+			want: "test/file/score=7/SBL256894",
+		},
+		{
+			name:     "custom template",
+			template: "{{.Prefix}}/{{.SourceName}}/{{.Comment}}",
+			data:     CommentData{SourceType: "file", SourceName: "file", Comment: "scanner"},
+			want:     "test/file/scanner",
+		},
+		{
+			name:     "source field",
+			template: "{{.SourceType}} {{.Source}}",
+			data:     CommentData{SourceType: "dns", SourceName: "dns/example.com", Source: "example.com"},
+			want:     "dns example.com",
+		},
+		{
+			name:      "truncated",
+			template:  "{{.Comment}}",
+			maxLength: 8,
+			data:      CommentData{Comment: "ÄÖÜ brute force"},
+			want:      "ÄÖÜ brut",
+		},
+		{
+			name:     "flattened",
+			template: "{{.Comment}}",
+			data:     CommentData{Comment: "line one\nline\ttwo\r\n"},
+			want:     "line one line two",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list := config.List{CommentTemplate: tt.template, CommentMaxLength: tt.maxLength}
+			c, err := newCommenter(list, config.ConfigDefaults{CommentPrefix: "test"})
+			if err != nil {
+				t.Fatalf("newCommenter() error = %v", err)
+			}
+			got, err := c.render(tt.data)
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("render() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCommenter_RenderUnknownField(t *testing.T) {
+	c, err := newCommenter(config.List{CommentTemplate: "{{.Reason}}"}, config.ConfigDefaults{})
+	if err != nil {
+		t.Fatalf("newCommenter() error = %v", err)
+	}
+	if _, err := c.render(CommentData{}); err == nil {
+		t.Errorf("render() expected error for unknown field")
+	}
+}
+
+func TestGenerator_GenerateListComments(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	input := "192.0.2.1 # brute force \"ssh\"\n192.0.2.2 scanner $evil\n192.0.2.3\n"
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {Files: []config.FileSource{{Path: path}}},
+		},
+	}
+
+	script, err := NewGenerator(cfg).GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	for _, line := range []string{
+		`$testAddIP "192.0.2.1" "test/file/brute force \"ssh\"" "1d"`,
+		`$testAddIP "192.0.2.2" "test/file/scanner \$evil" "1d"`,
+		`$testAddIP "192.0.2.3" "test/file" "1d"`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+}
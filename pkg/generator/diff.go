@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/netip"
+	"sync"
+)
+
+const diffTemplate = `
+:global {{.Function}};
+:set {{.Function}} do={
+:if ([ :len $3 ] = 0) do={
+:do { {{.Path}}/add list={{.ListName}} address=$1 comment="$2"; } on-error={ }
+} else={
+:do { {{.Path}}/add list={{.ListName}} address=$1 comment="$2" timeout=$3; } on-error={ }
+}
+}
+{{range .Removed}}
+:do { {{$.Path}}/remove [ find where list="{{escape $.ListName}}" address="{{escape .}}" ]; } on-error={ }{{end}}
+{{range .Entries}}
+${{$.Function}} "{{escape .Address}}" "{{escape .Comment}}" "{{escape .Timeout}}"{{end}}
+{{if .RetainedTimeout}}
+:do { {{.Path}}/set [ find where list="{{escape .ListName}}" dynamic ] timeout={{.RetainedTimeout}}; } on-error={ }{{else}}{{range .Retained}}
+:do { {{$.Path}}/set [ find where list="{{escape $.ListName}}" address="{{escape .Address}}" ] timeout={{.Timeout}}; } on-error={ }{{end}}{{end}}
+
+:set {{.Function}};
+`
+
+const versionTemplate = `
+:global {{.Variable}};
+:set {{.Variable}} "{{.Version}}";
+`
+
+// maxVersions is the number of previous versions remembered per list.
+// Routers reporting an older version receive a full script.
+const maxVersions = 8
+
+// versionStore remembers the entries of recently generated list versions
+// so that a router reporting one of them can be sent a diff.
+type versionStore struct {
+	mu       sync.Mutex
+	versions map[string]map[string][]Entry // list -> version -> entries
+	order    map[string][]string           // list -> versions, oldest first
+}
+
+func newVersionStore() *versionStore {
+	return &versionStore{
+		versions: make(map[string]map[string][]Entry),
+		order:    make(map[string][]string),
+	}
+}
+
+// record stores the entries of a list version, evicting the oldest
+// version once more than maxVersions are known.
+func (s *versionStore) record(list, version string, entries []Entry) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known, ok := s.versions[list]
+	if !ok {
+		known = make(map[string][]Entry)
+		s.versions[list] = known
+	}
+	if _, ok := known[version]; ok {
+		return
+	}
+
+	known[version] = entries
+	s.order[list] = append(s.order[list], version)
+	if len(s.order[list]) > maxVersions {
+		delete(known, s.order[list][0])
+		s.order[list] = s.order[list][1:]
+	}
+}
+
+// lookup returns the entries of the first version in since that is known
+// for list.
+func (s *versionStore) lookup(list string, since []string) ([]Entry, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, version := range since {
+		if entries, ok := s.versions[list][version]; ok {
+			return entries, true
+		}
+	}
+	return nil, false
+}
+
+// listVersion derives a version token from the list name and its entries,
+// so that a changed comment or timeout also yields a new version.
+func listVersion(list string, entries []Entry) string {
+	h := sha256.New()
+	h.Write([]byte(list))
+	for _, e := range entries {
+		b, _ := e.Prefix.MarshalBinary()
+		h.Write(b)
+		// Separate the variable length fields so they cannot run together
+		h.Write([]byte(e.Timeout + "\x00" + e.Comment + "\x00"))
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// diffBlock turns a full block into a diff against the entries the router
+// already has: new entries are added, dropped ones are removed and the
+// timeout of retained ones is refreshed so they do not expire. Retained
+// entries with a timeout are added again first, in case the router's copy
+// already expired; for entries still present the add fails and is ignored.
+// Retained permanent entries are left alone. Entries whose comment changed, or that
+// became permanent or started to expire, are removed and added again,
+// since RouterOS cannot clear the timeout of an entry.
+func diffBlock(data ScriptData, previous []Entry) ScriptData {
+	current := make(map[netip.Prefix]bool, len(data.Entries))
+	for _, entry := range data.Entries {
+		current[entry.Prefix] = true
+	}
+
+	old := make(map[netip.Prefix]Entry, len(previous))
+	for _, e := range previous {
+		if e.Prefix.Addr().Is4() != (data.Path == ipv4Path) {
+			continue
+		}
+		old[e.Prefix] = e
+		if !current[e.Prefix] {
+			data.Removed = append(data.Removed, e.Address())
+		}
+	}
+
+	var added, retained []Entry
+	for _, entry := range data.Entries {
+		prev, ok := old[entry.Prefix]
+		switch {
+		case !ok:
+			added = append(added, entry)
+		case prev.Comment != entry.Comment || (prev.Timeout == "") != (entry.Timeout == ""):
+			data.Removed = append(data.Removed, entry.Address())
+			added = append(added, entry)
+		case entry.Timeout != "":
+			// Permanent entries do not expire and need no refresh
+			added = append(added, entry)
+			retained = append(retained, entry)
+		}
+	}
+	data.Entries = added
+	data.Retained = retained
+
+	// A single timeout for all retained entries is refreshed in one command
+	if len(retained) > 0 {
+		data.RetainedTimeout = retained[0].Timeout
+		for _, entry := range retained {
+			if entry.Timeout != data.RetainedTimeout {
+				data.RetainedTimeout = ""
+				break
+			}
+		}
+	}
+
+	return data
+}
@@ -0,0 +1,255 @@
+package generator
+
+import (
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestGenerator_GenerateListDiff(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Family:    config.FamilyIPv4,
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.168.1.1", "10.0.0.0/24"}}},
+			},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	first, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	version := first.Versions["test"]
+	if !strings.Contains(first.Script, fmt.Sprintf(`:set testVersion "%s";`, version)) {
+		t.Errorf("GenerateListReport() script does not set version %s", version)
+	}
+
+	updated := cfg.Lists["test"]
+	updated.Addresses = []config.AddressGroup{{Addresses: []string{"192.168.1.1", "8.8.8.8"}}}
+
+	tests := []struct {
+		name     string
+		since    []string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:  "known version",
+			since: []string{"unknown", version},
+			want: []string{
+				`:do { /ip/firewall/address-list/remove [ find where list="test" address="10.0.0.0/24" ]; } on-error={ }`,
+				`:do { /ip/firewall/address-list/set [ find where list="test" dynamic ] timeout=1d; } on-error={ }`,
+				`$testAddIP "8.8.8.8" "test/static" "1d"`,
+				`$testAddIP "192.168.1.1" "test/static" "1d"`,
+			},
+			unwanted: []string{
+				`/ip/firewall/address-list/remove [ find where list="test" ];`,
+				`address="192.168.1.1" ]`,
+			},
+		},
+		{
+			name:  "unknown version",
+			since: []string{"unknown"},
+			want: []string{
+				`/ip/firewall/address-list/remove [ find where list="test" ];`,
+				`$testAddIP "192.168.1.1" "test/static" "1d"`,
+				`$testAddIP "8.8.8.8" "test/static" "1d"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			report, err := g.GenerateListReport("test", updated, Options{Since: tt.since})
+			if err != nil {
+				t.Fatalf("GenerateListReport() error = %v", err)
+			}
+			if report.Versions["test"] == version {
+				t.Errorf("GenerateListReport() version did not change")
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(report.Script, line) {
+					t.Errorf("GenerateListReport() script does not contain expected line: %s", line)
+				}
+			}
+			for _, line := range tt.unwanted {
+				if strings.Contains(report.Script, line) {
+					t.Errorf("GenerateListReport() script contains unexpected line: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestDiffBlock_MixedTimeouts(t *testing.T) {
+	data := ScriptData{
+		ListName: "test",
+		Path:     ipv4Path,
+		Entries: []Entry{
+			{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Timeout: "1h"},
+			{Prefix: netip.MustParsePrefix("10.0.0.2/32"), Timeout: "2h"},
+		},
+	}
+	previous := []Entry{
+		{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Timeout: "1h"},
+		{Prefix: netip.MustParsePrefix("10.0.0.2/32"), Timeout: "1h"},
+		{Prefix: netip.MustParsePrefix("2001:db8::1/128"), Timeout: "1h"},
+	}
+
+	got := diffBlock(data, previous)
+	if len(got.Entries) != 2 || len(got.Removed) != 0 {
+		t.Errorf("diffBlock() added = %v, removed = %v, want both re-added", got.Entries, got.Removed)
+	}
+	if len(got.Retained) != 2 || got.RetainedTimeout != "" {
+		t.Errorf("diffBlock() retained = %v, timeout = %q, want per-entry refresh", got.Retained, got.RetainedTimeout)
+	}
+}
+
+func TestDiffBlock_PermanentEntries(t *testing.T) {
+	data := ScriptData{
+		ListName: "test",
+		Path:     ipv4Path,
+		Entries: []Entry{
+			{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Timeout: "1h"},
+			{Prefix: netip.MustParsePrefix("10.0.0.2/32")},
+		},
+	}
+	previous := []Entry{
+		{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Timeout: "1h"},
+		{Prefix: netip.MustParsePrefix("10.0.0.2/32")},
+	}
+
+	got := diffBlock(data, previous)
+	if len(got.Retained) != 1 || got.RetainedTimeout != "1h" {
+		t.Errorf("diffBlock() retained = %v, timeout = %q, want only the expiring entry", got.Retained, got.RetainedTimeout)
+	}
+	if len(got.Entries) != 1 || got.Entries[0].Timeout != "1h" || len(got.Removed) != 0 {
+		t.Errorf("diffBlock() added = %v, removed = %v, want only the expiring entry re-added", got.Entries, got.Removed)
+	}
+}
+
+func TestDiffBlock_ChangedEntries(t *testing.T) {
+	data := ScriptData{
+		ListName: "test",
+		Path:     ipv4Path,
+		Entries: []Entry{
+			{Prefix: netip.MustParsePrefix("10.0.0.1/32")},
+			{Prefix: netip.MustParsePrefix("10.0.0.2/32"), Timeout: "1h"},
+			{Prefix: netip.MustParsePrefix("10.0.0.3/32"), Timeout: "1h", Comment: "new"},
+			{Prefix: netip.MustParsePrefix("10.0.0.4/32"), Timeout: "2h"},
+		},
+	}
+	previous := []Entry{
+		{Prefix: netip.MustParsePrefix("10.0.0.1/32"), Timeout: "1h"},
+		{Prefix: netip.MustParsePrefix("10.0.0.2/32")},
+		{Prefix: netip.MustParsePrefix("10.0.0.3/32"), Timeout: "1h", Comment: "old"},
+		{Prefix: netip.MustParsePrefix("10.0.0.4/32"), Timeout: "1h"},
+	}
+
+	got := diffBlock(data, previous)
+	want := []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"}
+	if !stringSliceEqual(got.Removed, want) {
+		t.Errorf("diffBlock() removed = %v, want %v", got.Removed, want)
+	}
+	var added []string
+	for _, e := range got.Entries {
+		added = append(added, e.Address())
+	}
+	if want := append(want, "10.0.0.4"); !stringSliceEqual(added, want) {
+		t.Errorf("diffBlock() added = %v, want %v", added, want)
+	}
+	if len(got.Retained) != 1 || got.RetainedTimeout != "2h" {
+		t.Errorf("diffBlock() retained = %v, timeout = %q, want the entry with a new timeout", got.Retained, got.RetainedTimeout)
+	}
+}
+
+func TestGenerator_GenerateListDiffTimeoutChange(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1h", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Family:    config.FamilyIPv4,
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.0.2.1"}}},
+			},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	first, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+
+	permanent := cfg.Lists["test"]
+	permanent.Timeout = config.TimeoutNone
+	report, err := g.GenerateListReport("test", permanent, Options{Since: []string{first.Versions["test"]}})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if report.Versions["test"] == first.Versions["test"] {
+		t.Errorf("GenerateListReport() version did not change with the timeout")
+	}
+	for _, line := range []string{
+		`:do { /ip/firewall/address-list/remove [ find where list="test" address="192.0.2.1" ]; } on-error={ }`,
+		`$testAddIP "192.0.2.1" "test/static" ""`,
+	} {
+		if !strings.Contains(report.Script, line) {
+			t.Errorf("GenerateListReport() script does not contain expected line: %s\n%s", line, report.Script)
+		}
+	}
+}
+
+func TestGenerator_GenerateListDiffExpiredEntry(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1h", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Family:    config.FamilyIPv4,
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.0.2.1"}}},
+			},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	first, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+
+	// The router polls after its copy of 192.0.2.1 expired, so refreshing
+	// the timeout alone would leave the address missing
+	report, err := g.GenerateListReport("test", cfg.Lists["test"], Options{Since: []string{first.Versions["test"]}})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	add := strings.Index(report.Script, `$testAddIP "192.0.2.1" "test/static" "01:00:00"`)
+	set := strings.Index(report.Script, `:do { /ip/firewall/address-list/set [ find where list="test" dynamic ] timeout=01:00:00; } on-error={ }`)
+	if add < 0 || set < 0 || add > set {
+		t.Errorf("GenerateListReport() script does not re-add the entry before refreshing its timeout:\n%s", report.Script)
+	}
+}
+
+func TestVersionStore_EvictsOldVersions(t *testing.T) {
+	s := newVersionStore()
+	for i := 0; i <= maxVersions; i++ {
+		s.record("test", fmt.Sprint(i), nil)
+	}
+
+	if _, ok := s.lookup("test", []string{"0"}); ok {
+		t.Errorf("lookup() found evicted version")
+	}
+	if _, ok := s.lookup("test", []string{fmt.Sprint(maxVersions)}); !ok {
+		t.Errorf("lookup() did not find latest version")
+	}
+	if _, ok := s.lookup("other", []string{"1"}); ok {
+		t.Errorf("lookup() found version of another list")
+	}
+}
@@ -0,0 +1,100 @@
+package generator
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// document is the raw body of a URL source together with the validators
+// needed for conditional requests.
+type document struct {
+	URL string `json:"url"`
+	// Key identifies the source the document was fetched for; see
+	// urlSource.key.
+	Key          string    `json:"key"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"lastModified,omitempty"`
+	FetchedAt    time.Time `json:"fetchedAt"`
+	Body         []byte    `json:"-"`
+}
+
+// documentPath returns the cache file prefix for a source key. Keys are
+// hashed so they can be used safely as file names.
+func documentPath(dir, key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(dir, hex.EncodeToString(sum[:]))
+}
+
+// loadDocument reads the persisted copy of the source with key from dir.
+// It returns nil without error if no copy exists.
+func loadDocument(dir, key string) (*document, error) {
+	path := documentPath(dir, key)
+
+	meta, err := os.ReadFile(path + ".json")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var doc document
+	if err := json.Unmarshal(meta, &doc); err != nil {
+		return nil, err
+	}
+	if doc.Key != key {
+		return nil, nil
+	}
+
+	doc.Body, err = os.ReadFile(path + ".body")
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &doc, nil
+}
+
+// saveDocument persists doc to dir. The body is written before the
+// metadata, so a crash never leaves metadata pointing at a partial body.
+func saveDocument(dir string, doc *document) error {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	meta, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+
+	path := documentPath(dir, doc.Key)
+	if err := writeFileAtomic(path+".body", doc.Body); err != nil {
+		return err
+	}
+	return writeFileAtomic(path+".json", meta)
+}
+
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
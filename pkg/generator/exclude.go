@@ -0,0 +1,185 @@
+package generator
+
+import (
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"sort"
+)
+
+// maxExclusionComments bounds the exclusions noted in a script, since a
+// country or a large allowlist can split many entries.
+const maxExclusionComments = 100
+
+// Exclusion records a part of the list removed by an exclude rule.
+type Exclusion struct {
+	List    string
+	Entry   netip.Prefix // prefix of the list entry that was hit
+	Removed netip.Prefix // part of the entry that was removed
+	Rule    netip.Prefix // exclude prefix that matched
+}
+
+func (e Exclusion) String() string {
+	return fmt.Sprintf("%s removed from %s (excluded by %s)",
+		formatPrefix(e.Removed), formatPrefix(e.Entry), formatPrefix(e.Rule))
+}
+
+// Comment renders the exclusion as a RouterOS script comment.
+func (e Exclusion) Comment() string {
+	return fmt.Sprintf("# list %s: %v", e.List, e)
+}
+
+// collectExclusions gathers the exclude prefixes of a list and of the
+// global configuration. Any source error is returned rather than skipped,
+// so a failing allowlist never lets protected networks through.
+func (g *Generator) collectExclusions(list config.List) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+
+	globalTemplate, err := g.globalURLSource()
+	if err != nil {
+		return nil, err
+	}
+	listTemplate, err := g.listURLSource(list)
+	if err != nil {
+		return nil, err
+	}
+
+	sources := []struct {
+		exclude     config.Exclude
+		urlTemplate urlSource
+	}{
+		{g.cfg.Config.Exclude, globalTemplate},
+		{list.Exclude, listTemplate},
+	}
+
+	for _, src := range sources {
+		exclude := src.exclude
+
+		// Process URLs
+		for _, u := range exclude.URLs {
+			if !u.IsEnabled() {
+				continue
+			}
+			us := src.urlTemplate.forURL(u)
+			result, err := g.cache.get(us)
+			if err != nil {
+				return nil, fmt.Errorf("error fetching exclusions from %s: %v", u.URL, err)
+			}
+			logInvalid(result)
+			prefixes = append(prefixes, result.Prefixes...)
+		}
+
+		// Process files
+		for _, file := range exclude.Files {
+			if !file.IsEnabled() {
+				continue
+			}
+			result, err := g.readFile(file)
+			if err != nil {
+				return nil, fmt.Errorf("error reading exclusions from %s: %v", file.Path, err)
+			}
+			logInvalid(result)
+			prefixes = append(prefixes, result.Prefixes...)
+		}
+
+		// Process countries
+		for _, country := range exclude.Countries {
+			code, err := config.ParseCountry(country)
+			if err != nil {
+				return nil, err
+			}
+			countryPrefixes, err := g.countries.lookup(code)
+			if err != nil {
+				return nil, fmt.Errorf("error reading exclusions for country %s: %v", code, err)
+			}
+			prefixes = append(prefixes, countryPrefixes...)
+		}
+
+		// Process static addresses
+		for _, addr := range exclude.Addresses {
+			parsed, err := ParseAddress(addr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid exclude address: %v", err)
+			}
+			prefixes = append(prefixes, parsed.Prefixes...)
+		}
+	}
+
+	return prefixes, nil
+}
+
+// excludeEntries subtracts the exclusion prefixes from entries. Entries
+// fully inside an exclusion are dropped; entries containing an exclusion
+// are split into the prefixes that remain. Split parts keep the comment
+// and timeout of the original entry.
+func excludeEntries(entries []Entry, exclusions []netip.Prefix) ([]Entry, []Exclusion) {
+	if len(exclusions) == 0 {
+		return entries, nil
+	}
+
+	rules := make([]Entry, 0, len(exclusions))
+	for _, prefix := range exclusions {
+		rules = append(rules, Entry{Prefix: prefix})
+	}
+	rules = aggregateEntries(rules, true)
+
+	var report []Exclusion
+	result := make([]Entry, 0, len(entries))
+	for _, entry := range entries {
+		pieces := []netip.Prefix{entry.Prefix}
+		// Rules are sorted and disjoint, so only the rule starting at or
+		// before the entry and those starting inside it can overlap it
+		first := sort.Search(len(rules), func(i int) bool {
+			return rules[i].Prefix.Addr().Compare(entry.Prefix.Addr()) > 0
+		})
+		last := lastAddr(entry.Prefix)
+		for i := max(first-1, 0); i < len(rules) && rules[i].Prefix.Addr().Compare(last) <= 0; i++ {
+			rule := rules[i]
+			if !rule.Prefix.Overlaps(entry.Prefix) {
+				continue
+			}
+			var remaining []netip.Prefix
+			for _, piece := range pieces {
+				switch {
+				case covers(rule.Prefix, piece):
+					report = append(report, Exclusion{Entry: entry.Prefix, Removed: piece, Rule: rule.Prefix})
+				case covers(piece, rule.Prefix):
+					report = append(report, Exclusion{Entry: entry.Prefix, Removed: rule.Prefix, Rule: rule.Prefix})
+					remaining = append(remaining, subtractPrefix(piece, rule.Prefix)...)
+				default:
+					remaining = append(remaining, piece)
+				}
+			}
+			pieces = remaining
+		}
+
+		sort.Slice(pieces, func(i, j int) bool {
+			return comparePrefix(pieces[i], pieces[j]) < 0
+		})
+		for _, piece := range pieces {
+			split := entry
+			split.Prefix = piece
+			result = append(result, split)
+		}
+	}
+
+	return result, report
+}
+
+// subtractPrefix returns the prefixes covering p minus ex, where ex is
+// strictly contained in p.
+func subtractPrefix(p, ex netip.Prefix) []netip.Prefix {
+	var remaining []netip.Prefix
+	for p.Bits() < ex.Bits() {
+		lo := netip.PrefixFrom(p.Addr(), p.Bits()+1)
+		hi := netip.PrefixFrom(lastAddr(lo).Next(), p.Bits()+1)
+		if lo.Contains(ex.Addr()) {
+			remaining = append(remaining, hi)
+			p = lo
+		} else {
+			remaining = append(remaining, lo)
+			p = hi
+		}
+	}
+	return remaining
+}
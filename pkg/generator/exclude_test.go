@@ -0,0 +1,177 @@
+package generator
+
+import (
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"strings"
+	"testing"
+)
+
+func TestExcludeEntries(t *testing.T) {
+	tests := []struct {
+		name        string
+		entries     []string
+		exclusions  []string
+		want        []string
+		wantRemoved int
+	}{
+		{
+			name:       "no exclusions",
+			entries:    []string{"10.0.0.0/24", "8.8.8.8/32"},
+			exclusions: nil,
+			want:       []string{"10.0.0.0/24", "8.8.8.8/32"},
+		},
+		{
+			name:        "exact match",
+			entries:     []string{"10.0.0.0/24", "8.8.8.8/32"},
+			exclusions:  []string{"8.8.8.8/32"},
+			want:        []string{"10.0.0.0/24"},
+			wantRemoved: 1,
+		},
+		{
+			name:        "entry inside exclusion",
+			entries:     []string{"192.168.1.0/24", "192.168.2.1/32", "1.1.1.1/32"},
+			exclusions:  []string{"192.168.0.0/16"},
+			want:        []string{"1.1.1.1/32"},
+			wantRemoved: 2,
+		},
+		{
+			name:        "exclusion inside entry",
+			entries:     []string{"10.0.0.0/30"},
+			exclusions:  []string{"10.0.0.2/32"},
+			want:        []string{"10.0.0.0/31", "10.0.0.3/32"},
+			wantRemoved: 1,
+		},
+		{
+			name:        "multiple exclusions inside entry",
+			entries:     []string{"10.0.0.0/29"},
+			exclusions:  []string{"10.0.0.1/32", "10.0.0.6/31"},
+			want:        []string{"10.0.0.0/32", "10.0.0.2/31", "10.0.0.4/31"},
+			wantRemoved: 2,
+		},
+		{
+			name:       "other family",
+			entries:    []string{"10.0.0.0/8"},
+			exclusions: []string{"2001:db8::/32"},
+			want:       []string{"10.0.0.0/8"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var entries []Entry
+			for _, s := range tt.entries {
+				entries = append(entries, Entry{Prefix: netip.MustParsePrefix(s), Comment: "c"})
+			}
+			var exclusions []netip.Prefix
+			for _, s := range tt.exclusions {
+				exclusions = append(exclusions, netip.MustParsePrefix(s))
+			}
+
+			got, removed := excludeEntries(entries, exclusions)
+
+			var prefixes []netip.Prefix
+			for _, e := range got {
+				prefixes = append(prefixes, e.Prefix)
+				if e.Comment != "c" {
+					t.Errorf("excludeEntries() entry %v lost its comment", e.Prefix)
+				}
+			}
+			if !stringSliceEqual(prefixStrings(prefixes), tt.want) {
+				t.Errorf("excludeEntries() = %v, want %v", prefixes, tt.want)
+			}
+			if len(removed) != tt.wantRemoved {
+				t.Errorf("excludeEntries() removed = %v, want %d entries", removed, tt.wantRemoved)
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListExclude(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+			Exclude: config.Exclude{
+				Addresses: []string{"10.0.0.0/8"},
+			},
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Family: config.FamilyIPv4,
+				Addresses: []config.AddressGroup{{Addresses: []string{
+					"10.1.2.3",
+					"192.168.1.0/30",
+					"8.8.8.8",
+				}}},
+				Exclude: config.Exclude{
+					Addresses: []string{"192.168.1.1"},
+				},
+			},
+		},
+	}
+
+	g := NewGenerator(cfg)
+	script, err := g.GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	want := []string{
+		`$testAddIP "8.8.8.8" "test/static" "1d"`,
+		`$testAddIP "192.168.1.0" "test/static" "1d"`,
+		`$testAddIP "192.168.1.2/31" "test/static" "1d"`,
+	}
+	for _, line := range want {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+	for _, addr := range []string{"10.1.2.3", "192.168.1.1", "192.168.1.0/30"} {
+		if strings.Contains(script, `$testAddIP "`+addr+`"`) {
+			t.Errorf("GenerateList() script contains excluded address: %s", addr)
+		}
+	}
+
+	// Removals are noted in the script instead of the log
+	for _, line := range []string{
+		"# list test: 10.1.2.3 removed from 10.1.2.3 (excluded by 10.0.0.0/8)",
+		"# list test: 192.168.1.1 removed from 192.168.1.0/30 (excluded by 192.168.1.1)",
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not note exclusion: %s", line)
+		}
+	}
+}
+
+func TestGenerator_GenerateListReportExclusions(t *testing.T) {
+	var addrs []string
+	for i := 1; i <= maxExclusionComments+50; i++ {
+		addrs = append(addrs, fmt.Sprintf("10.0.%d.%d", i/256, i%256))
+	}
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Family:    config.FamilyIPv4,
+				Addresses: []config.AddressGroup{{Addresses: append(addrs, "8.8.8.8")}},
+				Exclude:   config.Exclude{Addresses: []string{"10.0.0.0/8"}},
+			},
+		},
+	}
+
+	report, err := NewGenerator(cfg).GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if len(report.Exclusions) != len(addrs) {
+		t.Errorf("GenerateListReport() exclusions = %d, want %d", len(report.Exclusions), len(addrs))
+	}
+	if got := strings.Count(report.Script, "(excluded by 10.0.0.0/8)"); got != maxExclusionComments {
+		t.Errorf("GenerateListReport() script notes %d exclusions, want %d", got, maxExclusionComments)
+	}
+	if !strings.Contains(report.Script, "# list test: 50 more exclusions") {
+		t.Errorf("GenerateListReport() script does not summarize the remaining exclusions")
+	}
+}
@@ -0,0 +1,98 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"mk-addrlist-generator/pkg/config"
+	"strings"
+	"sync"
+)
+
+// Actions taken for a failed source.
+const (
+	ActionSkipped = "skipped"
+	ActionStale   = "stale"
+)
+
+// SourceError describes a list source that failed and how the failure was
+// handled.
+type SourceError struct {
+	List   string
+	Source string
+	Action string
+	Err    error
+}
+
+func (e SourceError) Error() string {
+	return fmt.Sprintf("list %s: source %s %s: %v", e.List, e.Source, e.Action, e.Err)
+}
+
+// redact removes the secrets of cfg from the error.
+func (e SourceError) redact(cfg *config.Config) SourceError {
+	if len(cfg.Secrets) == 0 {
+		return e
+	}
+	e.Source = cfg.Redact(e.Source)
+	e.Err = errors.New(cfg.Redact(e.Err.Error()))
+	return e
+}
+
+// Comment renders the error as a single-line RouterOS script comment.
+func (e SourceError) Comment() string {
+	return "# " + strings.Join(strings.Fields(e.Error()), " ")
+}
+
+// fileCache keeps the last good copy of every file source so the stale
+// policy can also be applied to files.
+type fileCache struct {
+	mu      sync.Mutex
+	results map[fileKey]ParseResult
+}
+
+// fileKey identifies what is read from a file source. Options such as the
+// name or timeout of the source do not change it.
+type fileKey struct {
+	path   string
+	parser config.Parser
+}
+
+func (c *fileCache) put(file config.FileSource, result ParseResult) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.results == nil {
+		c.results = make(map[fileKey]ParseResult)
+	}
+	c.results[fileKey{file.Path, file.Parser}] = result
+}
+
+func (c *fileCache) get(file config.FileSource) (ParseResult, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	result, ok := c.results[fileKey{file.Path, file.Parser}]
+	return result, ok
+}
+
+// handleSourceError applies the failure policy to a source error. It returns
+// the addresses to use instead, or an error if the whole list must fail.
+// The stale policy falls back to skipping when no previous copy exists.
+func handleSourceError[T any](list, source, policy string, err error, stale func() (T, bool), errs *[]SourceError) (T, error) {
+	var result T
+	if policy == config.OnErrorFail {
+		return result, err
+	}
+
+	srcErr := SourceError{List: list, Source: source, Action: ActionSkipped, Err: err}
+	if policy == config.OnErrorStale {
+		if last, ok := stale(); ok {
+			srcErr.Action = ActionStale
+			result = last
+		}
+	}
+
+	log.Printf("Source error: %v", srcErr)
+	*errs = append(*errs, srcErr)
+	return result, nil
+}
@@ -0,0 +1,151 @@
+package generator
+
+import (
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+func TestGenerator_GenerateListOnError(t *testing.T) {
+	var broken atomic.Bool
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if broken.Load() {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name       string
+		onError    string
+		wantErr    bool
+		wantAction string
+		wantStale  bool
+	}{
+		{
+			name:    "fail",
+			onError: config.OnErrorFail,
+			wantErr: true,
+		},
+		{
+			name:       "skip",
+			onError:    config.OnErrorSkip,
+			wantAction: ActionSkipped,
+		},
+		{
+			name:       "stale",
+			onError:    config.OnErrorStale,
+			wantAction: ActionStale,
+			wantStale:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Config: config.ConfigDefaults{
+					Timeout:       "1d",
+					CommentPrefix: "test",
+				},
+				Lists: map[string]config.List{
+					"test": {
+						OnError:   tt.onError,
+						Family:    config.FamilyIPv4,
+						URLs:      []config.URLSource{{URL: srv.URL}},
+						Addresses: []config.AddressGroup{{Addresses: []string{"8.8.8.8"}}},
+					},
+				},
+			}
+			g := NewGenerator(cfg)
+
+			broken.Store(false)
+			if _, err := g.GenerateList("test", cfg.Lists["test"]); err != nil {
+				t.Fatalf("GenerateList() error = %v", err)
+			}
+
+			broken.Store(true)
+			report, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GenerateListReport() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			script, errs := report.Script, report.SourceErrors
+
+			if len(errs) != 1 || errs[0].Action != tt.wantAction || errs[0].Source != srv.URL {
+				t.Fatalf("GenerateListReport() source errors = %v, want one %s", errs, tt.wantAction)
+			}
+			if !strings.Contains(script, errs[0].Comment()) {
+				t.Errorf("GenerateListReport() script does not contain comment: %s", errs[0].Comment())
+			}
+			if !strings.Contains(script, `"8.8.8.8"`) {
+				t.Errorf("GenerateListReport() script lost static addresses")
+			}
+			if got := strings.Contains(script, `"192.168.1.1"`); got != tt.wantStale {
+				t.Errorf("GenerateListReport() stale address present = %v, want %v", got, tt.wantStale)
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListStaleWithoutCopy(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout: "1d",
+			OnError: config.OnErrorStale,
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Files: []config.FileSource{{Path: "/nonexistent/list.txt"}},
+			},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	report, err := g.GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	errs := report.SourceErrors
+	if len(errs) != 1 || errs[0].Action != ActionSkipped {
+		t.Errorf("GenerateListReport() source errors = %v, want one skipped", errs)
+	}
+}
+
+func TestGenerator_GenerateListRedactsSecrets(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	defer srv.Close()
+
+	const key = "s3cr3t-api-key"
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout: "1d",
+			OnError: config.OnErrorSkip,
+		},
+		Lists: map[string]config.List{
+			"test": {
+				URLs:      []config.URLSource{{URL: srv.URL + "/feed?key=" + key}},
+				Addresses: []config.AddressGroup{{Addresses: []string{"8.8.8.8"}}},
+			},
+		},
+		Secrets: []string{key},
+	}
+
+	report, err := NewGenerator(cfg).GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if len(report.SourceErrors) != 1 {
+		t.Fatalf("GenerateListReport() source errors = %v, want one", report.SourceErrors)
+	}
+	if strings.Contains(report.Script, key) || strings.Contains(report.SourceErrors[0].Error(), key) {
+		t.Errorf("GenerateListReport() leaked the secret: %s", report.Script)
+	}
+}
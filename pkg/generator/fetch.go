@@ -0,0 +1,160 @@
+package generator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"time"
+)
+
+// statusError is returned for upstream responses outside the 2xx range.
+type statusError struct {
+	Code int
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("unexpected status %d %s", e.Code, http.StatusText(e.Code))
+}
+
+// permanentError marks fetch errors that retrying will not fix.
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentError) Unwrap() error {
+	return e.err
+}
+
+// fetchDocument downloads a URL source, retrying transient failures with
+// exponential backoff until ctx is cancelled. When prev is set, its
+// validators are sent as If-None-Match/If-Modified-Since and prev itself
+// is returned if the upstream answers 304 Not Modified.
+func (g *Generator) fetchDocument(ctx context.Context, src urlSource, prev *document) (*document, error) {
+	backoff := src.Fetch.RetryBackoff
+
+	for attempt := 0; ; attempt++ {
+		doc, err := g.fetchOnce(ctx, src, prev)
+		if err == nil {
+			return doc, nil
+		}
+		var permanent *permanentError
+		if errors.As(err, &permanent) || attempt >= src.Fetch.Retries {
+			return nil, err
+		}
+
+		log.Printf("Error fetching %s (attempt %d of %d), retrying in %v: %v",
+			src.URL, attempt+1, src.Fetch.Retries+1, backoff, err)
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+func (g *Generator) fetchOnce(ctx context.Context, src urlSource, prev *document) (*document, error) {
+	if src.Fetch.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, src.Fetch.Timeout)
+		defer cancel()
+	}
+
+	client, err := g.clients.get(src.HTTP.TLS)
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, src.URL, nil)
+	if err != nil {
+		return nil, &permanentError{err}
+	}
+	for name, value := range src.HTTP.Headers {
+		req.Header.Set(name, value)
+	}
+	if auth := src.HTTP.BasicAuth; auth != nil {
+		req.SetBasicAuth(auth.Username, auth.Password)
+	}
+	if src.HTTP.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+src.HTTP.BearerToken)
+	}
+	if prev != nil {
+		if prev.ETag != "" {
+			req.Header.Set("If-None-Match", prev.ETag)
+		}
+		if prev.LastModified != "" {
+			req.Header.Set("If-Modified-Since", prev.LastModified)
+		}
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified && prev != nil {
+		return prev, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		err := &statusError{Code: resp.StatusCode}
+		// Only server errors and rate limiting are worth retrying
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return nil, err
+		}
+		return nil, &permanentError{err}
+	}
+
+	if err := checkContentType(resp.Header.Get("Content-Type"), src.Fetch.ContentTypes); err != nil {
+		return nil, &permanentError{err}
+	}
+
+	var body []byte
+	if src.Fetch.MaxBodySize > 0 {
+		body, err = io.ReadAll(io.LimitReader(resp.Body, src.Fetch.MaxBodySize+1))
+		if err == nil && int64(len(body)) > src.Fetch.MaxBodySize {
+			return nil, &permanentError{fmt.Errorf("response body exceeds %d bytes", src.Fetch.MaxBodySize)}
+		}
+	} else {
+		body, err = io.ReadAll(resp.Body)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &document{
+		URL:          src.URL,
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Body:         body,
+	}, nil
+}
+
+// checkContentType verifies that the media type of a response is in
+// allowed. Missing headers and an empty allowlist accept anything.
+func checkContentType(header string, allowed []string) error {
+	if header == "" || len(allowed) == 0 {
+		return nil
+	}
+
+	mediaType, _, err := mime.ParseMediaType(header)
+	if err != nil {
+		return fmt.Errorf("invalid content type %q", header)
+	}
+	for _, a := range allowed {
+		if mediaType == a {
+			return nil
+		}
+	}
+	return fmt.Errorf("content type %s is not allowed", mediaType)
+}
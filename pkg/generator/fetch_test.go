@@ -0,0 +1,306 @@
+package generator
+
+import (
+	"context"
+	"encoding/pem"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestGenerator_FetchDocumentConditional(t *testing.T) {
+	var full, notModified int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") == `"v1"` &&
+			r.Header.Get("If-Modified-Since") == "Mon, 02 Jan 2006 15:04:05 GMT" {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		full++
+		w.Header().Set("ETag", `"v1"`)
+		w.Header().Set("Last-Modified", "Mon, 02 Jan 2006 15:04:05 GMT")
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+
+	g := NewGenerator(&config.Config{})
+
+	doc, err := g.fetchDocument(context.Background(), urlSource{URL: srv.URL}, nil)
+	if err != nil {
+		t.Fatalf("fetchDocument() error = %v", err)
+	}
+	if doc.ETag != `"v1"` || string(doc.Body) != "192.168.1.1\n" {
+		t.Errorf("fetchDocument() = %+v, unexpected document", doc)
+	}
+
+	again, err := g.fetchDocument(context.Background(), urlSource{URL: srv.URL}, doc)
+	if err != nil {
+		t.Fatalf("fetchDocument() error = %v", err)
+	}
+	if again != doc {
+		t.Errorf("fetchDocument() did not return previous document on 304")
+	}
+	if full != 1 || notModified != 1 {
+		t.Errorf("upstream full = %d, not modified = %d, want 1 and 1", full, notModified)
+	}
+}
+
+func TestSourceCache_PersistsToDisk(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		fmt.Fprintln(w, "192.168.1.1\n10.0.0.0/24")
+	}))
+	url := srv.URL
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			CacheDir: t.TempDir(),
+		},
+	}
+
+	if _, err := NewGenerator(cfg).cache.get(urlSource{URL: url}); err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	srv.Close()
+
+	// A new generator serves the persisted copy without network access
+	result, err := NewGenerator(cfg).cache.get(urlSource{URL: url, Refresh: time.Hour})
+	if err != nil {
+		t.Fatalf("get() error = %v", err)
+	}
+	if !stringSliceEqual(prefixStrings(result.Prefixes), []string{"192.168.1.1/32", "10.0.0.0/24"}) {
+		t.Errorf("get() = %v, want persisted addresses", result.Prefixes)
+	}
+
+	doc, err := loadDocument(cfg.Config.CacheDir, urlSource{URL: url}.key())
+	if err != nil || doc == nil {
+		t.Fatalf("loadDocument() = %v, %v", doc, err)
+	}
+	if doc.ETag != `"v1"` || doc.FetchedAt.IsZero() {
+		t.Errorf("loadDocument() = %+v, want persisted metadata", doc)
+	}
+}
+
+func TestGenerator_FetchDocumentRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		handler http.HandlerFunc
+		fetch   config.FetchOptions
+		wantErr bool
+	}{
+		{
+			name: "ok",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+				fmt.Fprintln(w, "192.168.1.1")
+			},
+			fetch:   config.FetchOptions{ContentTypes: config.DefaultContentTypes},
+			wantErr: false,
+		},
+		{
+			name: "not found",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				http.NotFound(w, r)
+			},
+			wantErr: true,
+		},
+		{
+			name: "html challenge page",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "text/html; charset=utf-8")
+				fmt.Fprintln(w, "<html>Just a moment...</html>")
+			},
+			fetch:   config.FetchOptions{ContentTypes: config.DefaultContentTypes},
+			wantErr: true,
+		},
+		{
+			name: "oversized body",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, "192.168.1.1\n192.168.1.2")
+			},
+			fetch:   config.FetchOptions{MaxBodySize: 16},
+			wantErr: true,
+		},
+		{
+			name: "timeout",
+			handler: func(w http.ResponseWriter, r *http.Request) {
+				time.Sleep(200 * time.Millisecond)
+				fmt.Fprintln(w, "192.168.1.1")
+			},
+			fetch:   config.FetchOptions{Timeout: 20 * time.Millisecond},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(tt.handler)
+			defer srv.Close()
+
+			g := NewGenerator(&config.Config{})
+			_, err := g.fetchDocument(context.Background(), urlSource{URL: srv.URL, Fetch: tt.fetch}, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fetchDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGenerator_FetchDocumentRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		retries  int
+		wantHits int
+		wantErr  bool
+	}{
+		{
+			name:     "recovers from server errors",
+			status:   http.StatusServiceUnavailable,
+			retries:  2,
+			wantHits: 3,
+			wantErr:  false,
+		},
+		{
+			name:     "gives up after retries",
+			status:   http.StatusServiceUnavailable,
+			retries:  1,
+			wantHits: 2,
+			wantErr:  true,
+		},
+		{
+			name:     "does not retry client errors",
+			status:   http.StatusForbidden,
+			retries:  2,
+			wantHits: 1,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hits := 0
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				hits++
+				if hits <= 2 {
+					w.WriteHeader(tt.status)
+					return
+				}
+				fmt.Fprintln(w, "192.168.1.1")
+			}))
+			defer srv.Close()
+
+			g := NewGenerator(&config.Config{})
+			src := urlSource{
+				URL: srv.URL,
+				Fetch: config.FetchOptions{
+					Retries:      tt.retries,
+					RetryBackoff: time.Millisecond,
+				},
+			}
+			_, err := g.fetchDocument(context.Background(), src, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fetchDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if hits != tt.wantHits {
+				t.Errorf("fetchDocument() upstream hits = %d, want %d", hits, tt.wantHits)
+			}
+		})
+	}
+}
+
+func TestGenerator_FetchDocumentAuth(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s|%s", r.Header.Get("Authorization"), r.Header.Get("X-Api-Key"))
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		name string
+		http config.HTTP
+		want string
+	}{
+		{
+			name: "headers",
+			http: config.HTTP{Headers: map[string]string{"X-Api-Key": "key"}},
+			want: "|key",
+		},
+		{
+			name: "basic auth",
+			http: config.HTTP{BasicAuth: &config.BasicAuth{Username: "user", Password: "pass"}},
+			want: "Basic dXNlcjpwYXNz|",
+		},
+		{
+			name: "bearer token",
+			http: config.HTTP{BearerToken: "token"},
+			want: "Bearer token|",
+		},
+	}
+
+	g := NewGenerator(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := g.fetchDocument(context.Background(), urlSource{URL: srv.URL, HTTP: tt.http}, nil)
+			if err != nil {
+				t.Fatalf("fetchDocument() error = %v", err)
+			}
+			if string(doc.Body) != tt.want {
+				t.Errorf("fetchDocument() sent %q, want %q", doc.Body, tt.want)
+			}
+		})
+	}
+}
+
+func TestGenerator_FetchDocumentTLS(t *testing.T) {
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+
+	caBundle := filepath.Join(t.TempDir(), "ca.pem")
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})
+	if err := os.WriteFile(caBundle, certPEM, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		tls     config.TLS
+		wantErr bool
+	}{
+		{
+			name:    "untrusted certificate",
+			wantErr: true,
+		},
+		{
+			name: "ca bundle",
+			tls:  config.TLS{CABundle: caBundle},
+		},
+		{
+			name: "insecure skip verify",
+			tls:  config.TLS{InsecureSkipVerify: true},
+		},
+		{
+			name:    "missing client key",
+			tls:     config.TLS{ClientCert: caBundle, ClientKey: "/nonexistent/key.pem"},
+			wantErr: true,
+		},
+	}
+
+	g := NewGenerator(&config.Config{})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := urlSource{URL: srv.URL, HTTP: config.HTTP{TLS: tt.tls}}
+			_, err := g.fetchDocument(context.Background(), src, nil)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("fetchDocument() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
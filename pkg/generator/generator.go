@@ -1,170 +1,813 @@
 package generator
 
 import (
-	"bufio"
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mk-addrlist-generator/pkg/config"
-	"net/http"
+	"net/netip"
 	"os"
 	"strings"
+	"sync"
 	"text/template"
+	"time"
 )
 
 const scriptTemplate = `
-/ip/firewall/address-list/remove [ find where list="{{.ListName}}" ];
-:global {{.ListName}}AddIP;
-:set {{.ListName}}AddIP do={
-:do { /ip/firewall/address-list/add list={{.ListName}} address=$1 comment="$2" timeout=$3; } on-error={ }
+{{.Path}}/remove [ find where list="{{escape .ListName}}" ];
+:global {{.Function}};
+:set {{.Function}} do={
+:if ([ :len $3 ] = 0) do={
+:do { {{.Path}}/add list={{.ListName}} address=$1 comment="$2"; } on-error={ }
+} else={
+:do { {{.Path}}/add list={{.ListName}} address=$1 comment="$2" timeout=$3; } on-error={ }
+}
+}
+{{range .Entries}}
+${{$.Function}} "{{escape .Address}}" "{{escape .Comment}}" "{{escape .Timeout}}"{{end}}
+
+:set {{.Function}};
+`
+
+// swapTemplate populates a staging list and then merges it into the live
+// list: new entries are copied over first and stale ones removed after, so
+// the live list always holds either the complete old or the complete new
+// set of addresses. A permanent entry already in the live list only has its
+// comment updated; since RouterOS cannot clear the timeout of an entry, it
+// is removed and added again only if the live copy is dynamic.
+const swapTemplate = `
+{{.Path}}/remove [ find where list="{{escape .Staging}}" ];
+:global {{.Function}};
+:set {{.Function}} do={
+:if ([ :len $3 ] = 0) do={
+:do { {{.Path}}/add list={{.Staging}} address=$1 comment="$2"; } on-error={ }
+} else={
+:do { {{.Path}}/add list={{.Staging}} address=$1 comment="$2" timeout=$3; } on-error={ }
+}
 }
 {{range .Entries}}
-${{$.ListName}}AddIP "{{.Address}}" "{{.Comment}}" "{{.Timeout}}"{{end}}
+${{$.Function}} "{{escape .Address}}" "{{escape .Comment}}" "{{escape .Timeout}}"{{end}}
 
-:set {{.ListName}}AddIP;
+:set {{.Function}};
+:foreach s in=[ {{.Path}}/find where list="{{escape .Staging}}" ] do={
+:local a [ {{.Path}}/get $s address ];
+:local c [ {{.Path}}/get $s comment ];
+:local t [ {{.Path}}/get $s timeout ];
+:local l [ {{.Path}}/find where list="{{escape .ListName}}" address=$a ];
+:if ([ :len $t ] = 0) do={
+:if ([ :len $l ] = 0) do={
+:do { {{.Path}}/add list={{.ListName}} address=$a comment=$c; } on-error={ }
+} else={
+:if ([ {{.Path}}/get $l dynamic ]) do={
+{{.Path}}/remove $l;
+:do { {{.Path}}/add list={{.ListName}} address=$a comment=$c; } on-error={ }
+} else={
+:do { {{.Path}}/set $l comment=$c; } on-error={ }
+}
+}
+} else={
+:if ([ :len $l ] = 0) do={
+:do { {{.Path}}/add list={{.ListName}} address=$a comment=$c timeout=$t; } on-error={ }
+} else={
+:do { {{.Path}}/set $l comment=$c timeout=$t; } on-error={ }
+}
+}
+}
+:foreach l in=[ {{.Path}}/find where list="{{escape .ListName}}" ] do={
+:local a [ {{.Path}}/get $l address ];
+:if ([ :len [ {{.Path}}/find where list="{{escape .Staging}}" address=$a ] ] = 0) do={
+{{.Path}}/remove $l;
+}
+}
+{{.Path}}/remove [ find where list="{{escape .Staging}}" ];
 `
 
+// scriptFuncs are the functions available to script templates.
+var scriptFuncs = template.FuncMap{
+	"escape": escapeString,
+}
+
+const (
+	ipv4Path = "/ip/firewall/address-list"
+	ipv6Path = "/ipv6/firewall/address-list"
+)
+
 type Generator struct {
-	cfg *config.Config
+	clients  clientCache
+	files    fileCache
+	versions *versionStore
+
+	// lifecycle serializes Start, Stop and Reload, which stop background
+	// refreshing without holding mu so that requests are not held up by
+	// fetches in progress. It guards running.
+	lifecycle sync.Mutex
+	running   bool
+
+	// mu guards the configuration and the state derived from it, which
+	// Reload replaces while lists are not being generated.
+	mu        sync.RWMutex
+	cfg       *config.Config
+	cache     *sourceCache
+	resolver  *cachingResolver
+	asns      *prefixTable[uint32]
+	countries *prefixTable[string]
 }
 
 type ScriptData struct {
 	ListName string
+	Path     string
+	Function string
 	Entries  []Entry
+
+	// Swap scripts only
+	Staging string
+
+	// Diff scripts only
+	Removed         []string
+	Retained        []Entry
+	RetainedTimeout string
+}
+
+// Report is the outcome of generating one or more lists.
+type Report struct {
+	Script string
+	// SourceErrors lists sources that failed but were skipped or served
+	// stale according to their onError policy.
+	SourceErrors []SourceError
+	// Exclusions lists the parts of entries that exclude rules removed.
+	Exclusions []Exclusion
+	// Versions maps each generated list to its version token.
+	Versions map[string]string
+}
+
+// Options tune a single generation request.
+type Options struct {
+	// Since holds the list versions the router currently has. A list
+	// whose version is known is rendered as a diff against it.
+	Since []string
 }
 
 type Entry struct {
-	Address string
+	Prefix  netip.Prefix
 	Comment string
+	// Timeout is empty for permanent entries.
 	Timeout string
 }
 
+// Address returns the entry formatted for a RouterOS address-list.
+func (e Entry) Address() string {
+	return formatPrefix(e.Prefix)
+}
+
+// LineError describes a source line that could not be parsed as an address.
+type LineError struct {
+	Source string
+	Line   int
+	Text   string
+	Err    error
+}
+
+func (e *LineError) Error() string {
+	return fmt.Sprintf("%s:%d: %q: %v", e.Source, e.Line, e.Text, e.Err)
+}
+
+// ParseResult holds the valid prefixes read from a source along with the
+// lines that were rejected.
+type ParseResult struct {
+	Prefixes []netip.Prefix
+	Invalid  []*LineError
+	// Metadata holds what the source says about individual prefixes.
+	Metadata map[netip.Prefix]Metadata
+}
+
+// Metadata is extra information a source carries for an address.
+type Metadata struct {
+	Score      float64
+	Scored     bool
+	Comment    string
+	Timeout    time.Duration
+	HasTimeout bool
+}
+
 func NewGenerator(cfg *config.Config) *Generator {
-	return &Generator{cfg: cfg}
+	g := &Generator{
+		cfg:       cfg,
+		resolver:  newCachingResolver(newDNSResolver(cfg.Config.Resolver)),
+		asns:      newASNTable(cfg.Config.ASNData.File),
+		countries: newCountryTable(cfg.Config.GeoData.Files, cfg.Config.GeoData.Locations),
+		versions:  newVersionStore(),
+	}
+	g.cache = newSourceCache(g.fetchDocument, cfg.Config.CacheDir)
+	return g
+}
+
+// Start launches background refresh of every URL source that has a
+// refresh interval configured, of the domains of every list, and of the
+// ASN and GeoIP data files.
+func (g *Generator) Start() {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.mu.RLock()
+	cfg, cache, resolver, asns, countries := g.cfg, g.cache, g.resolver, g.asns, g.countries
+	sources := g.refreshedSources()
+	domains := g.refreshedDomains()
+	g.mu.RUnlock()
+
+	g.running = true
+	cache.start(sources)
+	resolver.start(domains)
+	startTables(cfg, asns, countries)
+}
+
+// startTables launches background reloading of the given ASN and GeoIP
+// tables; nil tables are left alone.
+func startTables(cfg *config.Config, asns *prefixTable[uint32], countries *prefixTable[string]) {
+	if asns != nil {
+		if refresh, err := cfg.Config.ASNData.GetRefresh(); err != nil {
+			log.Printf("Error getting ASN data refresh interval: %v", err)
+		} else {
+			asns.start(refresh)
+		}
+	}
+	if countries != nil {
+		if refresh, err := cfg.Config.GeoData.GetRefresh(); err != nil {
+			log.Printf("Error getting GeoIP data refresh interval: %v", err)
+		} else {
+			countries.start(refresh)
+		}
+	}
+}
+
+// Stop terminates background refreshing, cancelling fetches in progress.
+func (g *Generator) Stop() {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.mu.RLock()
+	cache, resolver, asns, countries := g.cache, g.resolver, g.asns, g.countries
+	g.mu.RUnlock()
+
+	g.running = false
+	cache.stop()
+	resolver.stop()
+	asns.stop()
+	countries.stop()
+}
+
+// refreshedSources returns every URL source, including exclusions, that
+// is refreshed in the background. A source shared by several lists uses
+// the shortest refresh interval.
+func (g *Generator) refreshedSources() []urlSource {
+	sources := make(map[string]urlSource)
+	add := func(urls []config.URLSource, template urlSource) {
+		if template.Refresh <= 0 {
+			return
+		}
+		for _, u := range urls {
+			if !u.IsEnabled() {
+				continue
+			}
+			us := template.forURL(u)
+			if current, ok := sources[us.key()]; !ok || us.Refresh < current.Refresh {
+				sources[us.key()] = us
+			}
+		}
+	}
+
+	if template, err := g.globalURLSource(); err == nil {
+		add(g.cfg.Config.Exclude.URLs, template)
+	}
+	for _, list := range g.cfg.Lists {
+		template, err := g.listURLSource(list)
+		if err != nil {
+			continue
+		}
+		add(list.GetURLs(), template)
+		add(list.Exclude.URLs, template)
+	}
+
+	result := make([]urlSource, 0, len(sources))
+	for _, us := range sources {
+		result = append(result, us)
+	}
+	return result
+}
+
+// refreshedDomains returns the domains of every list, which are resolved
+// in the background.
+func (g *Generator) refreshedDomains() []string {
+	seen := make(map[string]bool)
+	var domains []string
+	for _, list := range g.cfg.Lists {
+		for _, domain := range list.Domains {
+			if !seen[domain] {
+				seen[domain] = true
+				domains = append(domains, domain)
+			}
+		}
+	}
+	return domains
+}
+
+// listURLSource resolves the refresh and fetch options shared by the URL
+// sources of a list. The URL itself is left empty.
+func (g *Generator) listURLSource(list config.List) (urlSource, error) {
+	refresh, err := list.GetRefresh(g.cfg.Config)
+	if err != nil {
+		return urlSource{}, fmt.Errorf("error getting refresh interval: %v", err)
+	}
+	fetch, err := list.GetFetch(g.cfg.Config)
+	if err != nil {
+		return urlSource{}, fmt.Errorf("error getting fetch options: %v", err)
+	}
+	return urlSource{Refresh: refresh, Fetch: fetch}, nil
+}
+
+// globalURLSource resolves the refresh and fetch options of the URL
+// sources in the global configuration.
+func (g *Generator) globalURLSource() (urlSource, error) {
+	refresh, err := g.cfg.Config.GetRefresh()
+	if err != nil {
+		return urlSource{}, fmt.Errorf("error getting refresh interval: %v", err)
+	}
+	fetch, err := g.cfg.Config.GetFetch()
+	if err != nil {
+		return urlSource{}, fmt.Errorf("error getting fetch options: %v", err)
+	}
+	return urlSource{Refresh: refresh, Fetch: fetch}, nil
 }
 
 func (g *Generator) GenerateAll() (string, error) {
+	report, err := g.GenerateAllReport(Options{})
+	return report.Script, err
+}
+
+// GenerateAllReport generates all lists and reports failed sources and
+// list versions along with the script.
+func (g *Generator) GenerateAllReport(opts Options) (Report, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
 	var result strings.Builder
+	report := Report{Versions: make(map[string]string)}
 
 	for name, list := range g.cfg.Lists {
-		script, err := g.GenerateList(name, list)
+		listReport, err := g.generateList(name, list, opts)
 		if err != nil {
-			return "", fmt.Errorf("error generating list %s: %v", name, err)
+			return Report{}, fmt.Errorf("error generating list %s: %v", name, err)
 		}
-		result.WriteString(script)
+		result.WriteString(listReport.Script)
 		result.WriteString("\n")
+		report.SourceErrors = append(report.SourceErrors, listReport.SourceErrors...)
+		report.Exclusions = append(report.Exclusions, listReport.Exclusions...)
+		report.Versions[name] = listReport.Versions[name]
 	}
 
-	return result.String(), nil
+	report.Script = result.String()
+	return report, nil
+}
+
+// ErrUnknownList is returned when generating a list that is not in the
+// configuration.
+var ErrUnknownList = errors.New("list not found")
+
+// Config returns the configuration currently in effect.
+func (g *Generator) Config() *config.Config {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.cfg
+}
+
+// GenerateNamedListReport generates the configured list name. The list is
+// looked up under the same lock it is generated with, so a concurrent
+// Reload cannot mix the list of one configuration with the state of
+// another. Unknown names yield an error wrapping ErrUnknownList.
+func (g *Generator) GenerateNamedListReport(name string, opts Options) (Report, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	list, ok := g.cfg.Lists[name]
+	if !ok {
+		return Report{}, fmt.Errorf("list %s: %w", name, ErrUnknownList)
+	}
+	return g.generateList(name, list, opts)
 }
 
 func (g *Generator) GenerateList(name string, list config.List) (string, error) {
+	report, err := g.GenerateListReport(name, list, Options{})
+	return report.Script, err
+}
+
+// GenerateListReport generates a single list and reports failed sources
+// and the list version along with the script. Failed sources are also
+// noted as comments in the script.
+func (g *Generator) GenerateListReport(name string, list config.List, opts Options) (Report, error) {
+	g.mu.RLock()
+	defer g.mu.RUnlock()
+
+	return g.generateList(name, list, opts)
+}
+
+func (g *Generator) generateList(name string, list config.List, opts Options) (Report, error) {
+	if err := config.ValidateListName(name); err != nil {
+		return Report{}, err
+	}
+
+	// The list timeout is only needed by sources without one of their own
 	timeout, err := list.GetTimeout(g.cfg.Config)
+	if err != nil && list.UsesListTimeout() {
+		return Report{}, fmt.Errorf("error getting timeout: %v", err)
+	}
+
+	urlTemplate, err := g.listURLSource(list)
 	if err != nil {
-		return "", fmt.Errorf("error getting timeout: %v", err)
+		return Report{}, err
 	}
 
-	commentPrefix := list.GetCommentPrefix(g.cfg.Config)
+	comments, err := newCommenter(list, g.cfg.Config)
+	if err != nil {
+		return Report{}, err
+	}
+	onError := list.GetOnError(g.cfg.Config)
 	entries := make([]Entry, 0)
+	var sourceErrors []SourceError
 
 	// Process URLs
-	for _, url := range list.URLs {
-		addresses, err := g.fetchAddresses(url)
+	for _, u := range list.GetURLs() {
+		us := urlTemplate.forURL(u)
+		urlTimeout, err := u.GetTimeout(timeout)
+		if err != nil {
+			return Report{}, fmt.Errorf("error getting timeout of %s: %v", u.URL, err)
+		}
+		result, err := g.cache.get(us)
 		if err != nil {
-			return "", fmt.Errorf("error fetching addresses from %s: %v", url, err)
+			stale := func() (ParseResult, bool) { return g.cache.stale(us) }
+			result, err = handleSourceError(name, u.URL, u.GetOnError(onError), err, stale, &sourceErrors)
+			if err != nil {
+				return Report{}, fmt.Errorf("error fetching addresses from %s: %v", u.URL, err)
+			}
+		} else if err := g.cache.lastError(us); err != nil && us.Refresh > 0 {
+			// The last background refresh failed, so the copy served is stale
+			sourceErrors = append(sourceErrors, SourceError{List: name, Source: u.URL, Action: ActionStale, Err: err})
 		}
-		for _, addr := range addresses {
+		logInvalid(result)
+		data := CommentData{SourceType: "url", SourceName: u.GetName("external"), Source: g.cfg.Redact(u.URL), Comment: u.Comment}
+		for _, prefix := range result.Prefixes {
+			comment, err := comments.render(sourceData(data, result, prefix))
+			if err != nil {
+				return Report{}, err
+			}
 			entries = append(entries, Entry{
-				Address: addr,
-				Comment: fmt.Sprintf("%s/external", commentPrefix),
-				Timeout: timeout.String(),
+				Prefix:  prefix,
+				Comment: comment,
+				Timeout: formatTimeout(urlTimeout),
 			})
 		}
 	}
 
 	// Process files
-	for _, file := range list.Files {
-		addresses, err := g.readAddresses(file)
+	for _, file := range list.GetFiles() {
+		fileTimeout, err := file.GetTimeout(timeout)
+		if err != nil {
+			return Report{}, fmt.Errorf("error getting timeout of %s: %v", file.Path, err)
+		}
+		result, err := g.readFile(file)
+		if err != nil {
+			stale := func() (ParseResult, bool) { return g.files.get(file) }
+			result, err = handleSourceError(name, file.Path, file.GetOnError(onError), err, stale, &sourceErrors)
+			if err != nil {
+				return Report{}, fmt.Errorf("error reading addresses from %s: %v", file.Path, err)
+			}
+		} else {
+			g.files.put(file, result)
+		}
+		logInvalid(result)
+		data := CommentData{SourceType: "file", SourceName: file.GetName("file"), Source: file.Path, Comment: file.Comment}
+		for _, prefix := range result.Prefixes {
+			comment, err := comments.render(sourceData(data, result, prefix))
+			if err != nil {
+				return Report{}, err
+			}
+			// Lines such as "192.0.2.1 timeout=2h" override the file's timeout
+			entryTimeout := fileTimeout
+			if meta := result.Metadata[prefix]; meta.HasTimeout {
+				entryTimeout = meta.Timeout
+			}
+			entries = append(entries, Entry{
+				Prefix:  prefix,
+				Comment: comment,
+				Timeout: formatTimeout(entryTimeout),
+			})
+		}
+	}
+
+	// Process domains
+	for _, domain := range list.Domains {
+		addrs, err := g.resolver.lookup(domain)
+		if err != nil {
+			stale := func() ([]ResolvedAddr, bool) { return g.resolver.stale(domain) }
+			addrs, err = handleSourceError(name, domain, onError, err, stale, &sourceErrors)
+			if err != nil {
+				return Report{}, fmt.Errorf("error resolving %s: %v", domain, err)
+			}
+		}
+		comment, err := comments.render(CommentData{SourceType: "dns", SourceName: "dns/" + domain, Source: domain})
+		if err != nil {
+			return Report{}, err
+		}
+		for _, addr := range addrs {
+			entryTimeout := timeout
+			if list.TTLTimeout {
+				entryTimeout = max(addr.TTL, time.Second)
+			}
+			entries = append(entries, Entry{
+				Prefix:  netip.PrefixFrom(addr.Addr, addr.Addr.BitLen()),
+				Comment: comment,
+				Timeout: formatTimeout(entryTimeout),
+			})
+		}
+	}
+
+	// Process AS numbers
+	for _, asn := range list.ASNs {
+		number, err := config.ParseASN(asn)
+		if err != nil {
+			return Report{}, err
+		}
+		source := fmt.Sprintf("AS%d", number)
+		prefixes, err := g.asns.lookup(number)
+		if err != nil {
+			// The table keeps its last good copy, so there is nothing older to fall back to
+			stale := func() ([]netip.Prefix, bool) { return nil, false }
+			prefixes, err = handleSourceError(name, source, onError, err, stale, &sourceErrors)
+			if err != nil {
+				return Report{}, fmt.Errorf("error expanding %s: %v", source, err)
+			}
+		} else if len(prefixes) == 0 {
+			log.Printf("List %s: %s has no prefixes in %s", name, source, g.cfg.Config.ASNData.File)
+		}
+		comment, err := comments.render(CommentData{SourceType: "asn", SourceName: "asn/" + source, Source: source})
+		if err != nil {
+			return Report{}, err
+		}
+		for _, prefix := range prefixes {
+			entries = append(entries, Entry{
+				Prefix:  prefix,
+				Comment: comment,
+				Timeout: formatTimeout(timeout),
+			})
+		}
+	}
+
+	// Process countries
+	for _, country := range list.Countries {
+		code, err := config.ParseCountry(country)
+		if err != nil {
+			return Report{}, err
+		}
+		source := "country:" + code
+		prefixes, err := g.countries.lookup(code)
+		if err != nil {
+			stale := func() ([]netip.Prefix, bool) { return nil, false }
+			prefixes, err = handleSourceError(name, source, onError, err, stale, &sourceErrors)
+			if err != nil {
+				return Report{}, fmt.Errorf("error expanding %s: %v", source, err)
+			}
+		} else if len(prefixes) == 0 {
+			log.Printf("List %s: no networks for country %s", name, code)
+		}
+		comment, err := comments.render(CommentData{SourceType: "country", SourceName: "geo/" + code, Source: code})
 		if err != nil {
-			return "", fmt.Errorf("error reading addresses from %s: %v", file, err)
+			return Report{}, err
 		}
-		for _, addr := range addresses {
+		for _, prefix := range prefixes {
 			entries = append(entries, Entry{
-				Address: addr,
-				Comment: fmt.Sprintf("%s/file", commentPrefix),
-				Timeout: timeout.String(),
+				Prefix:  prefix,
+				Comment: comment,
+				Timeout: formatTimeout(timeout),
 			})
 		}
 	}
 
 	// Process static addresses
-	for _, addr := range list.Addresses {
-		entries = append(entries, Entry{
-			Address: addr,
-			Comment: fmt.Sprintf("%s/static", commentPrefix),
-			Timeout: timeout.String(),
-		})
+	for _, group := range list.GetAddresses() {
+		groupTimeout, err := group.GetTimeout(timeout)
+		if err != nil {
+			return Report{}, fmt.Errorf("error getting timeout of static addresses: %v", err)
+		}
+		staticComment, err := comments.render(CommentData{SourceType: "static", SourceName: group.GetName("static"), Comment: group.Comment})
+		if err != nil {
+			return Report{}, err
+		}
+		for _, addr := range group.Addresses {
+			parsed, err := ParseAddress(addr)
+			if err != nil {
+				return Report{}, fmt.Errorf("invalid static address: %v", err)
+			}
+			for _, prefix := range parsed.Prefixes {
+				entries = append(entries, Entry{
+					Prefix:  prefix,
+					Comment: staticComment,
+					Timeout: formatTimeout(groupTimeout),
+				})
+			}
+		}
 	}
 
+	// Keep secrets such as API keys in URLs out of the script and headers
+	for i, e := range sourceErrors {
+		sourceErrors[i] = e.redact(g.cfg)
+	}
+
+	// Remove duplicates and covered prefixes, merging adjacent ones if requested
+	entries = aggregateEntries(entries, list.Aggregate)
+
+	// Subtract excluded networks
+	exclusions, err := g.collectExclusions(list)
+	if err != nil {
+		return Report{}, err
+	}
+	entries, removed := excludeEntries(entries, exclusions)
+	for i := range removed {
+		removed[i].List = name
+	}
+
+	// Keep only the address families the list is emitted for
+	family := list.GetFamily()
+	var ipv4, ipv6, kept []Entry
+	for _, entry := range entries {
+		is4 := entry.Prefix.Addr().Is4()
+		if (is4 && family == config.FamilyIPv6) || (!is4 && family == config.FamilyIPv4) {
+			continue
+		}
+		if is4 {
+			ipv4 = append(ipv4, entry)
+		} else {
+			ipv6 = append(ipv6, entry)
+		}
+		kept = append(kept, entry)
+	}
+
+	// Remember this version and look up the one the router reported
+	version := listVersion(name, kept)
+	previous, isDiff := g.versions.lookup(name, opts.Since)
+	g.versions.record(name, version, kept)
+
 	// Generate script
-	tmpl, err := template.New("script").Parse(scriptTemplate)
+	text := scriptTemplate
+	switch {
+	case isDiff:
+		text = diffTemplate
+	case list.GetUpdateStrategy() == config.UpdateSwap:
+		text = swapTemplate
+	}
+	tmpl, err := template.New("script").Funcs(scriptFuncs).Parse(text)
 	if err != nil {
-		return "", fmt.Errorf("error parsing template: %v", err)
+		return Report{}, fmt.Errorf("error parsing template: %v", err)
 	}
 
-	data := ScriptData{
-		ListName: name,
-		Entries:  entries,
+	// Global variables are named after the list, with "." and "-" replaced
+	variable := config.ScriptIdentifier(name)
+	var blocks []ScriptData
+	if family != config.FamilyIPv6 {
+		blocks = append(blocks, ScriptData{
+			ListName: name,
+			Path:     ipv4Path,
+			Function: variable + "AddIP",
+			Entries:  ipv4,
+			Staging:  name + "-staging",
+		})
+	}
+	if family != config.FamilyIPv4 {
+		blocks = append(blocks, ScriptData{
+			ListName: name,
+			Path:     ipv6Path,
+			Function: variable + "AddIPv6",
+			Entries:  ipv6,
+			Staging:  name + "-staging",
+		})
 	}
 
 	var buf bytes.Buffer
-	if err := tmpl.Execute(&buf, data); err != nil {
-		return "", fmt.Errorf("error executing template: %v", err)
+	for _, e := range sourceErrors {
+		buf.WriteString("\n" + e.Comment())
+	}
+	for i, e := range removed {
+		if i == maxExclusionComments {
+			fmt.Fprintf(&buf, "\n# list %s: %d more exclusions", name, len(removed)-i)
+			break
+		}
+		buf.WriteString("\n" + e.Comment())
+	}
+	for _, data := range blocks {
+		if isDiff {
+			data = diffBlock(data, previous)
+		}
+		if err := tmpl.Execute(&buf, data); err != nil {
+			return Report{}, fmt.Errorf("error executing template: %v", err)
+		}
 	}
 
-	return buf.String(), nil
-}
-
-func (g *Generator) fetchAddresses(url string) ([]string, error) {
-	resp, err := http.Get(url)
+	versionTmpl, err := template.New("version").Parse(versionTemplate)
+	if err != nil {
+		return Report{}, fmt.Errorf("error parsing template: %v", err)
+	}
+	err = versionTmpl.Execute(&buf, struct{ Variable, Version string }{variable + "Version", version})
 	if err != nil {
-		return nil, err
+		return Report{}, fmt.Errorf("error executing template: %v", err)
 	}
-	defer resp.Body.Close()
 
-	return readAddresses(resp.Body)
+	return Report{
+		Script:       buf.String(),
+		SourceErrors: sourceErrors,
+		Exclusions:   removed,
+		Versions:     map[string]string{name: version},
+	}, nil
+}
+
+// formatTimeout renders an entry timeout for the add command in RouterOS
+// notation. Permanent entries, with a zero timeout, are added without one.
+func formatTimeout(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return config.FormatDuration(d)
 }
 
-func (g *Generator) readAddresses(path string) ([]string, error) {
-	file, err := os.Open(path)
+// readFile parses a file source with its configured parser.
+func (g *Generator) readFile(src config.FileSource) (ParseResult, error) {
+	file, err := os.Open(src.Path)
 	if err != nil {
-		return nil, err
+		return ParseResult{}, err
 	}
 	defer file.Close()
 
-	return readAddresses(file)
+	return parseSource(file, src.Path, src.Parser)
 }
 
-func readAddresses(r io.Reader) ([]string, error) {
-	var addresses []string
-	scanner := bufio.NewScanner(r)
+// readAddresses reads one address per line. Text after "#" and any
+// fields following the address are kept as the comment of the address,
+// except for a "timeout=" field, which sets the timeout of the address.
+func readAddresses(r io.Reader, source string) (ParseResult, error) {
+	var result ParseResult
+	err := scanLines(r, func(lineNo int, line string) {
+		var comment string
+		if before, after, ok := strings.Cut(line, "#"); ok {
+			line, comment = strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+		if line == "" {
+			return
+		}
 
-	for scanner.Scan() {
-		line := strings.TrimSpace(scanner.Text())
-		if line != "" && !strings.HasPrefix(line, "#") {
-			// Remove inline comments
-			if idx := strings.Index(line, "#"); idx != -1 {
-				line = strings.TrimSpace(line[:idx])
+		var meta Metadata
+		if strings.Contains(line, "timeout=") {
+			var rest []string
+			for _, field := range strings.Fields(line) {
+				value, ok := strings.CutPrefix(field, "timeout=")
+				if !ok {
+					rest = append(rest, field)
+					continue
+				}
+				timeout, err := config.ParseTimeout(value)
+				if err != nil {
+					result.Invalid = append(result.Invalid, &LineError{
+						Source: source,
+						Line:   lineNo,
+						Text:   line,
+						Err:    fmt.Errorf("invalid timeout: %v", err),
+					})
+					return
+				}
+				meta.Timeout, meta.HasTimeout = timeout, true
 			}
-			if line != "" {
-				addresses = append(addresses, line)
+			line = strings.Join(rest, " ")
+		}
+
+		// Keep trailing metadata such as "192.0.2.1 scanner" as the comment
+		if fields := strings.Fields(line); len(fields) > 1 {
+			if _, err := ParseAddress(line); err != nil {
+				if _, err := ParseAddress(fields[0]); err == nil {
+					line = fields[0]
+					comment = strings.TrimSpace(strings.Join(fields[1:], " ") + " " + comment)
+				}
 			}
 		}
-	}
 
-	if err := scanner.Err(); err != nil {
-		return nil, err
+		meta.Comment = comment
+		result.annotate(result.add(source, lineNo, line), meta)
+	})
+	if err != nil {
+		return ParseResult{}, err
 	}
+	return result, nil
+}
 
-	return addresses, nil
+func logInvalid(result ParseResult) {
+	for _, e := range result.Invalid {
+		log.Printf("Skipping invalid address: %v", e)
+	}
 }
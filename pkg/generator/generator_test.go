@@ -2,6 +2,9 @@ package generator
 
 import (
 	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 )
@@ -14,10 +17,10 @@ func TestGenerator_GenerateList(t *testing.T) {
 		},
 		Lists: map[string]config.List{
 			"test": {
-				Addresses: []string{
+				Addresses: []config.AddressGroup{{Addresses: []string{
 					"192.168.1.1",
 					"10.0.0.0/24",
-				},
+				}}},
 			},
 		},
 	}
@@ -36,8 +39,8 @@ func TestGenerator_GenerateList(t *testing.T) {
 		`:set testAddIP do={`,
 		`:do { /ip/firewall/address-list/add list=test address=$1 comment="$2" timeout=$3; } on-error={ }`,
 		`}`,
-		`$testAddIP "192.168.1.1" "test/static" "24h0m0s"`,
-		`$testAddIP "10.0.0.0/24" "test/static" "24h0m0s"`,
+		`$testAddIP "192.168.1.1" "test/static" "1d"`,
+		`$testAddIP "10.0.0.0/24" "test/static" "1d"`,
 		`:set testAddIP;`,
 	}
 
@@ -48,6 +51,142 @@ func TestGenerator_GenerateList(t *testing.T) {
 	}
 }
 
+func TestGenerator_GenerateListFamilies(t *testing.T) {
+	addresses := []string{"192.168.1.1", "2001:db8::/32"}
+
+	tests := []struct {
+		name     string
+		family   string
+		want     []string
+		unwanted []string
+	}{
+		{
+			name:   "both",
+			family: "",
+			want: []string{
+				`/ip/firewall/address-list/remove [ find where list="test" ];`,
+				`$testAddIP "192.168.1.1" "test/static" "1d"`,
+				`/ipv6/firewall/address-list/remove [ find where list="test" ];`,
+				`:do { /ipv6/firewall/address-list/add list=test address=$1 comment="$2" timeout=$3; } on-error={ }`,
+				`$testAddIPv6 "2001:db8::/32" "test/static" "1d"`,
+				`:set testAddIPv6;`,
+			},
+			unwanted: []string{
+				`$testAddIP "2001:db8::/32"`,
+				`$testAddIPv6 "192.168.1.1"`,
+			},
+		},
+		{
+			name:   "ipv4 only",
+			family: config.FamilyIPv4,
+			want: []string{
+				`$testAddIP "192.168.1.1" "test/static" "1d"`,
+			},
+			unwanted: []string{
+				`/ipv6/firewall/address-list`,
+				`2001:db8::/32`,
+			},
+		},
+		{
+			name:   "ipv6 only",
+			family: config.FamilyIPv6,
+			want: []string{
+				`$testAddIPv6 "2001:db8::/32" "test/static" "1d"`,
+			},
+			unwanted: []string{
+				`/ip/firewall/address-list`,
+				`192.168.1.1`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Config: config.ConfigDefaults{
+					Timeout:       "1d",
+					CommentPrefix: "test",
+				},
+				Lists: map[string]config.List{
+					"test": {
+						Family:    tt.family,
+						Addresses: []config.AddressGroup{{Addresses: addresses}},
+					},
+				},
+			}
+
+			g := NewGenerator(cfg)
+			script, err := g.GenerateList("test", cfg.Lists["test"])
+			if err != nil {
+				t.Fatalf("GenerateList() error = %v", err)
+			}
+
+			for _, line := range tt.want {
+				if !strings.Contains(script, line) {
+					t.Errorf("GenerateList() script does not contain expected line: %s", line)
+				}
+			}
+			for _, line := range tt.unwanted {
+				if strings.Contains(script, line) {
+					t.Errorf("GenerateList() script contains unexpected text: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListSwap(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Family:         config.FamilyIPv4,
+				UpdateStrategy: config.UpdateSwap,
+				Addresses:      []config.AddressGroup{{Addresses: []string{"192.168.1.1"}}},
+			},
+		},
+	}
+
+	g := NewGenerator(cfg)
+	script, err := g.GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	expectedLines := []string{
+		`/ip/firewall/address-list/remove [ find where list="test-staging" ];`,
+		`:do { /ip/firewall/address-list/add list=test-staging address=$1 comment="$2" timeout=$3; } on-error={ }`,
+		`$testAddIP "192.168.1.1" "test/static" "1d"`,
+		`:foreach s in=[ /ip/firewall/address-list/find where list="test-staging" ] do={`,
+		`:do { /ip/firewall/address-list/add list=test address=$a comment=$c timeout=$t; } on-error={ }`,
+		`:foreach l in=[ /ip/firewall/address-list/find where list="test" ] do={`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+
+	// Permanent entries already in the live list keep their place unless
+	// they have to lose a timeout
+	for _, line := range []string{
+		`:if ([ /ip/firewall/address-list/get $l dynamic ]) do={`,
+		`:do { /ip/firewall/address-list/set $l comment=$c; } on-error={ }`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+
+	// The live list must never be emptied in one go
+	if strings.Contains(script, `/ip/firewall/address-list/remove [ find where list="test" ];`) {
+		t.Errorf("GenerateList() swap script removes the whole live list")
+	}
+}
+
 func TestGenerator_GenerateAll(t *testing.T) {
 	cfg := &config.Config{
 		Config: config.ConfigDefaults{
@@ -56,14 +195,14 @@ func TestGenerator_GenerateAll(t *testing.T) {
 		},
 		Lists: map[string]config.List{
 			"list1": {
-				Addresses: []string{
+				Addresses: []config.AddressGroup{{Addresses: []string{
 					"192.168.1.1",
-				},
+				}}},
 			},
 			"list2": {
-				Addresses: []string{
+				Addresses: []config.AddressGroup{{Addresses: []string{
 					"10.0.0.0/24",
-				},
+				}}},
 			},
 		},
 	}
@@ -85,16 +224,17 @@ func TestGenerator_GenerateAll(t *testing.T) {
 
 func TestReadAddresses(t *testing.T) {
 	tests := []struct {
-		name    string
-		input   string
-		want    []string
-		wantErr bool
+		name        string
+		input       string
+		want        []string
+		wantInvalid []int
+		wantErr     bool
 	}{
 		{
 			name:  "simple addresses",
 			input: "192.168.1.1\n10.0.0.0/24",
 			want: []string{
-				"192.168.1.1",
+				"192.168.1.1/32",
 				"10.0.0.0/24",
 			},
 			wantErr: false,
@@ -103,7 +243,7 @@ func TestReadAddresses(t *testing.T) {
 			name:  "with comments",
 			input: "192.168.1.1 # First address\n# Comment line\n10.0.0.0/24",
 			want: []string{
-				"192.168.1.1",
+				"192.168.1.1/32",
 				"10.0.0.0/24",
 			},
 			wantErr: false,
@@ -112,7 +252,7 @@ func TestReadAddresses(t *testing.T) {
 			name:  "empty lines",
 			input: "\n192.168.1.1\n\n10.0.0.0/24\n",
 			want: []string{
-				"192.168.1.1",
+				"192.168.1.1/32",
 				"10.0.0.0/24",
 			},
 			wantErr: false,
@@ -121,28 +261,156 @@ func TestReadAddresses(t *testing.T) {
 			name:  "whitespace",
 			input: "  192.168.1.1  \n  10.0.0.0/24  ",
 			want: []string{
-				"192.168.1.1",
+				"192.168.1.1/32",
+				"10.0.0.0/24",
+			},
+			wantErr: false,
+		},
+		{
+			name:  "canonicalized prefix",
+			input: "10.0.0.5/8",
+			want: []string{
+				"10.0.0.0/8",
+			},
+			wantErr: false,
+		},
+		{
+			name:  "timeout field",
+			input: "192.168.1.1 timeout=2h scanner\n10.0.0.0/24 timeout=none",
+			want: []string{
+				"192.168.1.1/32",
 				"10.0.0.0/24",
 			},
 			wantErr: false,
 		},
+		{
+			name:        "invalid timeout field",
+			input:       "192.168.1.1 timeout=soon\n10.0.0.0/24",
+			want:        []string{"10.0.0.0/24"},
+			wantInvalid: []int{1},
+			wantErr:     false,
+		},
+		{
+			name:  "invalid lines",
+			input: "192.168.1.1\nexample.com\n<html>\n10.0.0.0/24",
+			want: []string{
+				"192.168.1.1/32",
+				"10.0.0.0/24",
+			},
+			wantInvalid: []int{2, 3},
+			wantErr:     false,
+		},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			r := strings.NewReader(tt.input)
-			got, err := readAddresses(r)
+			got, err := readAddresses(r, "test")
 			if (err != nil) != tt.wantErr {
 				t.Errorf("readAddresses() error = %v, wantErr %v", err, tt.wantErr)
 				return
 			}
-			if !stringSliceEqual(got, tt.want) {
-				t.Errorf("readAddresses() = %v, want %v", got, tt.want)
+			if !stringSliceEqual(prefixStrings(got.Prefixes), tt.want) {
+				t.Errorf("readAddresses() = %v, want %v", got.Prefixes, tt.want)
+			}
+			if len(got.Invalid) != len(tt.wantInvalid) {
+				t.Fatalf("readAddresses() invalid = %v, want lines %v", got.Invalid, tt.wantInvalid)
+			}
+			for i, line := range tt.wantInvalid {
+				if got.Invalid[i].Line != line || got.Invalid[i].Source != "test" {
+					t.Errorf("readAddresses() invalid[%d] = %v, want line %d", i, got.Invalid[i], line)
+				}
 			}
 		})
 	}
 }
 
+func TestGenerator_GenerateListTimeouts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	input := "192.0.2.1\n192.0.2.2 timeout=2h\n192.0.2.3 timeout=none\n"
+	if err := os.WriteFile(path, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Files: []config.FileSource{{Path: path, SourceOptions: config.SourceOptions{Timeout: "30m"}}},
+				Addresses: []config.AddressGroup{
+					{Addresses: []string{"10.0.0.0/8"}},
+					{Addresses: []string{"192.168.0.0/16"}, SourceOptions: config.SourceOptions{Timeout: config.TimeoutNone}},
+				},
+			},
+		},
+	}
+
+	script, err := NewGenerator(cfg).GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	expectedLines := []string{
+		`:do { /ip/firewall/address-list/add list=test address=$1 comment="$2"; } on-error={ }`,
+		`$testAddIP "10.0.0.0/8" "test/static" "1d"`,
+		`$testAddIP "192.0.2.1" "test/file" "00:30:00"`,
+		`$testAddIP "192.0.2.2" "test/file" "02:00:00"`,
+		`$testAddIP "192.0.2.3" "test/file" ""`,
+		`$testAddIP "192.168.0.0/16" "test/static" ""`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s\n%s", line, script)
+		}
+	}
+}
+
+func TestGenerator_GenerateListSourceTimeoutsOnly(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Addresses: []config.AddressGroup{
+					{Addresses: []string{"10.0.0.0/8"}, SourceOptions: config.SourceOptions{Timeout: "1h"}},
+					{Addresses: []string{"192.168.0.0/16"}, SourceOptions: config.SourceOptions{Timeout: config.TimeoutNone}},
+				},
+			},
+		},
+	}
+	if err := config.ValidateConfig(cfg); err != nil {
+		t.Fatalf("ValidateConfig() error = %v", err)
+	}
+
+	g := NewGenerator(cfg)
+	script, err := g.GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+	for _, line := range []string{
+		`$testAddIP "10.0.0.0/8" "test/static" "01:00:00"`,
+		`$testAddIP "192.168.0.0/16" "test/static" ""`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s\n%s", line, script)
+		}
+	}
+
+	// A source falling back on the list timeout still needs one
+	list := cfg.Lists["test"]
+	list.Addresses = append(list.Addresses, config.AddressGroup{Addresses: []string{"172.16.0.0/12"}})
+	if _, err := g.GenerateList("test", list); err == nil {
+		t.Error("GenerateList() expected error for a source without timeout")
+	}
+}
+
+func prefixStrings(prefixes []netip.Prefix) []string {
+	var s []string
+	for _, p := range prefixes {
+		s = append(s, p.String())
+	}
+	return s
+}
+
 func stringSliceEqual(a, b []string) bool {
 	if len(a) != len(b) {
 		return false
@@ -154,3 +422,138 @@ func stringSliceEqual(a, b []string) bool {
 	}
 	return true
 }
+
+func TestGenerator_GenerateListInvalidStatic(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout: "1d",
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Addresses: []config.AddressGroup{{Addresses: []string{"not-an-address"}}},
+			},
+		},
+	}
+
+	g := NewGenerator(cfg)
+	if _, err := g.GenerateList("test", cfg.Lists["test"]); err == nil {
+		t.Error("GenerateList() expected error for invalid static address")
+	}
+}
+
+func TestGenerator_GenerateListSources(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.1\n192.0.2.2 # scanner\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	disabled := false
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Family: config.FamilyIPv4,
+				Sources: []config.Source{
+					{Type: config.SourceFile, Location: path, SourceOptions: config.SourceOptions{Name: "local", Comment: "office"}},
+					{Type: config.SourceFile, Location: "/nonexistent/list.txt", SourceOptions: config.SourceOptions{OnError: config.OnErrorSkip}},
+					{Type: config.SourceFile, Location: "/nonexistent/disabled.txt", SourceOptions: config.SourceOptions{Enabled: &disabled}},
+					{Type: config.SourceStatic, Location: "10.0.0.0/8", SourceOptions: config.SourceOptions{Name: "partners", Timeout: config.TimeoutNone}},
+				},
+				Addresses: []config.AddressGroup{{Addresses: []string{"172.16.0.0/12"}}},
+			},
+		},
+	}
+
+	report, err := NewGenerator(cfg).GenerateListReport("test", cfg.Lists["test"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+	if len(report.SourceErrors) != 1 || report.SourceErrors[0].Source != "/nonexistent/list.txt" {
+		t.Errorf("GenerateListReport() source errors = %v, want one for the missing file", report.SourceErrors)
+	}
+
+	expectedLines := []string{
+		`$testAddIP "192.0.2.1" "test/local/office" "1d"`,
+		`$testAddIP "192.0.2.2" "test/local/scanner" "1d"`,
+		`$testAddIP "10.0.0.0/8" "test/partners" ""`,
+		`$testAddIP "172.16.0.0/12" "test/static" "1d"`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(report.Script, line) {
+			t.Errorf("GenerateListReport() script does not contain expected line: %s\n%s", line, report.Script)
+		}
+	}
+}
+
+func TestGenerator_GenerateListVariableNames(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"my-list.v2": {
+				Addresses: []config.AddressGroup{{Addresses: []string{"192.0.2.1", "2001:db8::1"}}},
+			},
+		},
+	}
+
+	report, err := NewGenerator(cfg).GenerateListReport("my-list.v2", cfg.Lists["my-list.v2"], Options{})
+	if err != nil {
+		t.Fatalf("GenerateListReport() error = %v", err)
+	}
+
+	expectedLines := []string{
+		`/ip/firewall/address-list/remove [ find where list="my-list.v2" ];`,
+		`:global my_list_v2AddIP;`,
+		`:do { /ip/firewall/address-list/add list=my-list.v2 address=$1 comment="$2" timeout=$3; } on-error={ }`,
+		`$my_list_v2AddIP "192.0.2.1" "test/static" "1d"`,
+		`$my_list_v2AddIPv6 "2001:db8::1" "test/static" "1d"`,
+		`:set my_list_v2AddIPv6;`,
+		`:global my_list_v2Version;`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(report.Script, line) {
+			t.Errorf("GenerateListReport() script does not contain expected line: %s\n%s", line, report.Script)
+		}
+	}
+	for _, unwanted := range []string{"$my-list", ":global my-list", ":set my-list"} {
+		if strings.Contains(report.Script, unwanted) {
+			t.Errorf("GenerateListReport() script uses the list name as a variable: %s", unwanted)
+		}
+	}
+}
+
+func TestGenerator_GenerateListPermanentStatic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "list.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.0/24\n198.51.100.7\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1h", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Family: config.FamilyIPv4,
+				Files:  []config.FileSource{{Path: path}},
+				Addresses: []config.AddressGroup{{
+					Addresses:     []string{"192.0.2.1", "198.51.100.7"},
+					SourceOptions: config.SourceOptions{Timeout: config.TimeoutNone},
+				}},
+			},
+		},
+	}
+
+	script, err := NewGenerator(cfg).GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	expectedLines := []string{
+		`$testAddIP "192.0.2.0/24" "test/file" "01:00:00"`,
+		`$testAddIP "192.0.2.1" "test/static" ""`,
+		`$testAddIP "198.51.100.7" "test/static" ""`,
+	}
+	for _, line := range expectedLines {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s\n%s", line, script)
+		}
+	}
+}
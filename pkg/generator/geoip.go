@@ -0,0 +1,217 @@
+package generator
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"log"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// newCountryTable returns a table of the networks assigned to each ISO
+// country code, read from local MaxMind DB (.mmdb) or CSV files.
+// locations is the GeoLite2 locations CSV, only needed for GeoLite2 CSV
+// block files; it is watched for changes along with the other files.
+func newCountryTable(files []string, locations string) *prefixTable[string] {
+	paths := append([]string(nil), files...)
+	if locations != "" {
+		paths = append(paths, locations)
+	}
+	read := func([]string) (map[string][]netip.Prefix, error) {
+		return readCountryFiles(files, locations)
+	}
+	return newPrefixTable("geoData", paths, read)
+}
+
+func readCountryFiles(files []string, locations string) (map[string][]netip.Prefix, error) {
+	var geonames map[string]string
+	if locations != "" {
+		var err error
+		if geonames, err = readGeoLocations(locations); err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", locations, err)
+		}
+	}
+
+	table := make(map[string][]netip.Prefix)
+	for _, path := range files {
+		var err error
+		if strings.EqualFold(filepath.Ext(path), ".mmdb") {
+			err = readMMDBCountries(path, table)
+		} else {
+			err = readCSVCountries(path, geonames, table)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %v", path, err)
+		}
+	}
+	return table, nil
+}
+
+// readMMDBCountries adds the networks of a GeoLite2 or DB-IP country
+// database to table. Networks without a country use their registered
+// country.
+func readMMDBCountries(path string, table map[string][]netip.Prefix) error {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	db, err := newMMDBReader(buf)
+	if err != nil {
+		return err
+	}
+
+	// Many networks share a data record, so decode each one only once
+	codes := make(map[uint32]string)
+	return db.networks(func(prefix netip.Prefix, offset uint32) error {
+		code, ok := codes[offset]
+		if !ok {
+			record, err := db.decode(offset)
+			if err != nil {
+				return err
+			}
+			code = mmdbCountry(record)
+			codes[offset] = code
+		}
+		if code != "" {
+			table[code] = append(table[code], prefix)
+		}
+		return nil
+	})
+}
+
+func mmdbCountry(record any) string {
+	fields, _ := record.(map[string]any)
+	for _, key := range []string{"country", "registered_country"} {
+		country, _ := fields[key].(map[string]any)
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return strings.ToUpper(code)
+		}
+	}
+	return ""
+}
+
+// readCSVCountries adds the networks of a country CSV file to table. The
+// following layouts are recognized:
+//
+//   - GeoLite2 blocks, with a header starting with "network": the country
+//     is taken from a country_iso_code column or resolved from the
+//     geoname_id (or registered_country_geoname_id) column via geonames
+//   - DB-IP, without header: start,end,country
+//   - network,country, without header
+func readCSVCountries(path string, geonames map[string]string, table map[string][]netip.Prefix) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.ReuseRecord = true
+
+	header := map[string]int(nil)
+	invalid := 0
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		if line == 1 && len(record) > 0 && strings.TrimSpace(record[0]) == "network" {
+			header = make(map[string]int, len(record))
+			for i, name := range record {
+				header[strings.TrimSpace(name)] = i
+			}
+			if _, ok := header["country_iso_code"]; !ok && geonames == nil {
+				return fmt.Errorf("GeoLite2 block files need geoData locations")
+			}
+			continue
+		}
+
+		var address, code string
+		switch {
+		case header != nil:
+			address = record[0]
+			code = csvColumn(record, header, "country_iso_code")
+			for _, column := range []string{"geoname_id", "registered_country_geoname_id"} {
+				if code != "" {
+					break
+				}
+				code = geonames[csvColumn(record, header, column)]
+			}
+		case len(record) >= 3:
+			address = strings.TrimSpace(record[0]) + "-" + strings.TrimSpace(record[1])
+			code = record[2]
+		case len(record) == 2:
+			address, code = record[0], record[1]
+		}
+
+		code = strings.ToUpper(strings.TrimSpace(code))
+		parsed, err := ParseAddress(strings.TrimSpace(address))
+		if err != nil || code == "" {
+			invalid++
+			continue
+		}
+		table[code] = append(table[code], parsed.Prefixes...)
+	}
+
+	if invalid > 0 {
+		log.Printf("Skipped %d invalid lines in %s", invalid, path)
+	}
+	return nil
+}
+
+// readGeoLocations maps the geoname IDs of a GeoLite2 locations CSV to
+// their country codes.
+func readGeoLocations(path string) (map[string]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, fmt.Errorf("empty locations file")
+	}
+
+	header := make(map[string]int)
+	for i, name := range records[0] {
+		header[strings.TrimSpace(name)] = i
+	}
+	if _, ok := header["geoname_id"]; !ok {
+		return nil, fmt.Errorf("missing geoname_id column")
+	}
+	if _, ok := header["country_iso_code"]; !ok {
+		return nil, fmt.Errorf("missing country_iso_code column")
+	}
+
+	geonames := make(map[string]string, len(records)-1)
+	for _, record := range records[1:] {
+		if code := csvColumn(record, header, "country_iso_code"); code != "" {
+			geonames[csvColumn(record, header, "geoname_id")] = strings.ToUpper(code)
+		}
+	}
+	return geonames, nil
+}
+
+func csvColumn(record []string, header map[string]int, name string) string {
+	i, ok := header[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return strings.TrimSpace(record[i])
+}
@@ -0,0 +1,369 @@
+package generator
+
+import (
+	"encoding/binary"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// testMMDB builds a MaxMind DB file with 24-bit records mapping networks
+// to country codes.
+type testMMDB struct {
+	ipVersion int
+	nodes     [][2]testRecord
+	data      []byte
+	offsets   map[string]int
+}
+
+type testRecord struct {
+	kind  int // 0 empty, 1 node, 2 data
+	value int
+}
+
+func newTestMMDB(ipVersion int) *testMMDB {
+	return &testMMDB{ipVersion: ipVersion, nodes: make([][2]testRecord, 1), offsets: make(map[string]int)}
+}
+
+func (m *testMMDB) insert(network string, rec testRecord) {
+	prefix := netip.MustParsePrefix(network)
+	addr := prefix.Addr().AsSlice()
+	bits := prefix.Bits()
+	if m.ipVersion == 6 && prefix.Addr().Is4() {
+		addr = append(make([]byte, 12), addr...)
+		bits += 96
+	}
+
+	node := 0
+	for i := 0; i < bits; i++ {
+		bit := int(addr[i/8]>>(7-i%8)) & 1
+		if i == bits-1 {
+			m.nodes[node][bit] = rec
+			return
+		}
+		if m.nodes[node][bit].kind != 1 {
+			m.nodes = append(m.nodes, [2]testRecord{})
+			m.nodes[node][bit] = testRecord{kind: 1, value: len(m.nodes) - 1}
+		}
+		node = m.nodes[node][bit].value
+	}
+}
+
+func (m *testMMDB) add(network, country string) {
+	offset, ok := m.offsets[country]
+	if !ok {
+		offset = len(m.data)
+		m.offsets[country] = offset
+		m.data = append(m.data, 0xe1)
+		m.data = appendTestString(m.data, "country")
+		m.data = append(m.data, 0xe1)
+		m.data = appendTestString(m.data, "iso_code")
+		m.data = appendTestString(m.data, country)
+	}
+	m.insert(network, testRecord{kind: 2, value: offset})
+}
+
+func (m *testMMDB) bytes() []byte {
+	var buf []byte
+	nodeCount := len(m.nodes)
+	for _, node := range m.nodes {
+		for _, rec := range node {
+			v := nodeCount
+			switch rec.kind {
+			case 1:
+				v = rec.value
+			case 2:
+				v = nodeCount + 16 + rec.value
+			}
+			buf = append(buf, byte(v>>16), byte(v>>8), byte(v))
+		}
+	}
+	buf = append(buf, make([]byte, 16)...)
+	buf = append(buf, m.data...)
+
+	buf = append(buf, mmdbMetadataMarker...)
+	buf = append(buf, 0xe3)
+	buf = appendTestString(buf, "node_count")
+	buf = append(buf, 0xc4)
+	buf = binary.BigEndian.AppendUint32(buf, uint32(nodeCount))
+	buf = appendTestString(buf, "record_size")
+	buf = append(buf, 0xa2, 0, 24)
+	buf = appendTestString(buf, "ip_version")
+	buf = append(buf, 0xa2, 0, byte(m.ipVersion))
+	return buf
+}
+
+func appendTestString(buf []byte, s string) []byte {
+	return append(append(buf, 0x40|byte(len(s))), s...)
+}
+
+func countryStrings(table map[string][]netip.Prefix, code string) []string {
+	prefixes := append([]netip.Prefix(nil), table[code]...)
+	sort.Slice(prefixes, func(i, j int) bool { return comparePrefix(prefixes[i], prefixes[j]) < 0 })
+	return prefixStrings(prefixes)
+}
+
+func TestReadMMDBCountries(t *testing.T) {
+	tests := []struct {
+		name      string
+		ipVersion int
+		build     func(m *testMMDB)
+		want      map[string][]string
+	}{
+		{
+			name:      "ipv4 database",
+			ipVersion: 4,
+			build: func(m *testMMDB) {
+				m.add("192.0.2.0/24", "DE")
+				m.add("198.51.100.0/25", "FR")
+				m.add("203.0.113.0/24", "DE")
+			},
+			want: map[string][]string{
+				"DE": {"192.0.2.0/24", "203.0.113.0/24"},
+				"FR": {"198.51.100.0/25"},
+			},
+		},
+		{
+			name:      "ipv6 database with ipv4 aliases",
+			ipVersion: 6,
+			build: func(m *testMMDB) {
+				m.add("192.0.2.0/24", "DE")
+				m.add("2001:db8::/32", "DE")
+				m.add("2001:db9::/32", "FR")
+				// ::ffff:0:0/96 points back into the IPv4 subtree
+				ipv4Start := 0
+				for i := 0; i < 96; i++ {
+					ipv4Start = m.nodes[ipv4Start][0].value
+				}
+				m.insert("::ffff:0:0/96", testRecord{kind: 1, value: ipv4Start})
+			},
+			want: map[string][]string{
+				"DE": {"192.0.2.0/24", "2001:db8::/32"},
+				"FR": {"2001:db9::/32"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := newTestMMDB(tt.ipVersion)
+			tt.build(m)
+			path := filepath.Join(t.TempDir(), "country.mmdb")
+			if err := os.WriteFile(path, m.bytes(), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			table := make(map[string][]netip.Prefix)
+			if err := readMMDBCountries(path, table); err != nil {
+				t.Fatalf("readMMDBCountries() error = %v", err)
+			}
+			if len(table) != len(tt.want) {
+				t.Errorf("readMMDBCountries() countries = %d, want %d", len(table), len(tt.want))
+			}
+			for code, want := range tt.want {
+				if got := countryStrings(table, code); !stringSliceEqual(got, want) {
+					t.Errorf("readMMDBCountries() %s = %v, want %v", code, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadCSVCountries(t *testing.T) {
+	dir := t.TempDir()
+	locations := filepath.Join(dir, "GeoLite2-Country-Locations-en.csv")
+	if err := os.WriteFile(locations, []byte(`geoname_id,locale_code,continent_code,continent_name,country_iso_code,country_name,is_in_european_union
+2921044,en,EU,Europe,DE,Germany,1
+3017382,en,EU,Europe,FR,France,1
+`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	geonames, err := readGeoLocations(locations)
+	if err != nil {
+		t.Fatalf("readGeoLocations() error = %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		input string
+		want  map[string][]string
+	}{
+		{
+			name: "geolite2 blocks",
+			input: `network,geoname_id,registered_country_geoname_id,represented_country_geoname_id,is_anonymous_proxy,is_satellite_provider
+192.0.2.0/24,2921044,2921044,,0,0
+198.51.100.0/24,,3017382,,0,0
+`,
+			want: map[string][]string{
+				"DE": {"192.0.2.0/24"},
+				"FR": {"198.51.100.0/24"},
+			},
+		},
+		{
+			name: "dbip ranges",
+			input: `192.0.2.0,192.0.2.255,DE
+2001:db8::,2001:db8:ffff:ffff:ffff:ffff:ffff:ffff,de
+198.51.100.0,198.51.100.127,FR
+`,
+			want: map[string][]string{
+				"DE": {"192.0.2.0/24", "2001:db8::/32"},
+				"FR": {"198.51.100.0/25"},
+			},
+		},
+		{
+			name: "network and country",
+			input: `# comment
+192.0.2.0/24,DE
+not-a-network,FR
+`,
+			want: map[string][]string{
+				"DE": {"192.0.2.0/24"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "country.csv")
+			if err := os.WriteFile(path, []byte(tt.input), 0644); err != nil {
+				t.Fatal(err)
+			}
+
+			table := make(map[string][]netip.Prefix)
+			if err := readCSVCountries(path, geonames, table); err != nil {
+				t.Fatalf("readCSVCountries() error = %v", err)
+			}
+			if len(table) != len(tt.want) {
+				t.Errorf("readCSVCountries() countries = %d, want %d", len(table), len(tt.want))
+			}
+			for code, want := range tt.want {
+				if got := countryStrings(table, code); !stringSliceEqual(got, want) {
+					t.Errorf("readCSVCountries() %s = %v, want %v", code, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListCountries(t *testing.T) {
+	m := newTestMMDB(4)
+	m.add("192.0.2.0/24", "DE")
+	m.add("198.51.100.0/24", "FR")
+	m.add("203.0.113.0/24", "NL")
+	path := filepath.Join(t.TempDir(), "country.mmdb")
+	if err := os.WriteFile(path, m.bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{
+			Timeout:       "1d",
+			CommentPrefix: "test",
+			GeoData:       config.GeoData{Files: []string{path}},
+		},
+		Lists: map[string]config.List{
+			"test": {
+				Countries: []string{"de", "FR"},
+				Addresses: []config.AddressGroup{{Addresses: []string{"203.0.113.10"}}},
+				Exclude:   config.Exclude{Countries: []string{"NL"}},
+			},
+		},
+	}
+
+	g := NewGenerator(cfg)
+	script, err := g.GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	for _, line := range []string{
+		`$testAddIP "192.0.2.0/24" "test/geo/DE" "1d"`,
+		`$testAddIP "198.51.100.0/24" "test/geo/FR" "1d"`,
+	} {
+		if !strings.Contains(script, line) {
+			t.Errorf("GenerateList() script does not contain expected line: %s", line)
+		}
+	}
+	if strings.Contains(script, `$testAddIP "203.0.113`) {
+		t.Errorf("GenerateList() script contains address of excluded country")
+	}
+}
+
+func TestMMDBDecoder_Corrupt(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{
+			name: "pointer to itself",
+			data: []byte{0x20, 0x00},
+		},
+		{
+			name: "pointer to pointer",
+			data: []byte{0x20, 0x02, 0x20, 0x00},
+		},
+		{
+			name: "map containing a pointer to itself",
+			data: []byte{0xe1, 0x41, 'a', 0x20, 0x00},
+		},
+		{
+			name: "map fanning out to itself",
+			data: []byte{0xe2, 0x41, 'a', 0x20, 0x00, 0x41, 'b', 0x20, 0x00},
+		},
+		{
+			name: "array larger than the data section",
+			data: []byte{0x1f, 0x04, 0xff, 0xff, 0xff},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := (&mmdbDecoder{buf: tt.data}).decode(0); err == nil {
+				t.Errorf("decode() expected error for corrupt data")
+			}
+		})
+	}
+}
+
+func TestReadMMDBCountries_SharedNodes(t *testing.T) {
+	// Every node points both of its records to the next one, so the tree
+	// describes 2^100 paths in a few hundred bytes
+	m := newTestMMDB(4)
+	m.nodes = make([][2]testRecord, 100)
+	for i := 0; i < 99; i++ {
+		m.nodes[i] = [2]testRecord{{kind: 1, value: i + 1}, {kind: 1, value: i + 1}}
+	}
+
+	db, err := newMMDBReader(m.bytes())
+	if err != nil {
+		t.Fatalf("newMMDBReader() error = %v", err)
+	}
+	if err := db.networks(func(netip.Prefix, uint32) error { return nil }); err == nil {
+		t.Errorf("networks() expected error for shared nodes")
+	}
+}
+
+func FuzzMMDB(f *testing.F) {
+	m := newTestMMDB(6)
+	m.add("192.0.2.0/24", "DE")
+	m.add("2001:db8::/32", "FR")
+	f.Add(m.bytes())
+	f.Add([]byte{0xe1, 0x41, 'a', 0x20, 0x00})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		(&mmdbDecoder{buf: data}).decode(0)
+
+		db, err := newMMDBReader(data)
+		if err != nil {
+			return
+		}
+		db.networks(func(_ netip.Prefix, offset uint32) error {
+			_, err := db.decode(offset)
+			return err
+		})
+	})
+}
@@ -0,0 +1,383 @@
+package generator
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+)
+
+// mmdbMetadataMarker starts the metadata section at the end of a MaxMind
+// DB file.
+var mmdbMetadataMarker = []byte("\xab\xcd\xefMaxMind.com")
+
+// mmdbReader is a minimal reader for the MaxMind DB format, enough to walk
+// every network of a GeoLite2 or DB-IP country database.
+type mmdbReader struct {
+	buf        []byte
+	nodeCount  uint32
+	recordSize uint16
+	ipVersion  uint16
+	data       []byte // data section
+}
+
+func newMMDBReader(buf []byte) (*mmdbReader, error) {
+	idx := bytes.LastIndex(buf, mmdbMetadataMarker)
+	if idx < 0 {
+		return nil, fmt.Errorf("not a MaxMind DB file")
+	}
+	metaStart := idx + len(mmdbMetadataMarker)
+	meta, _, err := (&mmdbDecoder{buf: buf[metaStart:]}).decode(0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid metadata: %v", err)
+	}
+	fields, ok := meta.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("invalid metadata")
+	}
+
+	r := &mmdbReader{buf: buf}
+	nodeCount, ok1 := fields["node_count"].(uint64)
+	recordSize, ok2 := fields["record_size"].(uint64)
+	ipVersion, ok3 := fields["ip_version"].(uint64)
+	if !ok1 || !ok2 || !ok3 {
+		return nil, fmt.Errorf("metadata is missing node_count, record_size or ip_version")
+	}
+	r.nodeCount = uint32(nodeCount)
+	r.recordSize = uint16(recordSize)
+	r.ipVersion = uint16(ipVersion)
+
+	switch r.recordSize {
+	case 24, 28, 32:
+	default:
+		return nil, fmt.Errorf("unsupported record size %d", r.recordSize)
+	}
+
+	treeSize := int(r.recordSize) * 2 / 8 * int(r.nodeCount)
+	if treeSize+16 > idx {
+		return nil, fmt.Errorf("search tree exceeds file size")
+	}
+	r.data = buf[treeSize+16 : idx]
+	return r, nil
+}
+
+// record returns the left (bit 0) or right (bit 1) record of a node.
+func (r *mmdbReader) record(node uint32, bit int) (uint32, error) {
+	size := int(r.recordSize) * 2 / 8
+	off := int(node) * size
+	if off+size > len(r.buf) {
+		return 0, fmt.Errorf("node %d out of range", node)
+	}
+	b := r.buf[off : off+size]
+
+	switch r.recordSize {
+	case 24:
+		b = b[bit*3:]
+		return uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]), nil
+	case 28:
+		if bit == 0 {
+			return uint32(b[3]&0xf0)<<20 | uint32(b[0])<<16 | uint32(b[1])<<8 | uint32(b[2]), nil
+		}
+		return uint32(b[3]&0x0f)<<24 | uint32(b[4])<<16 | uint32(b[5])<<8 | uint32(b[6]), nil
+	default:
+		return binary.BigEndian.Uint32(b[bit*4:]), nil
+	}
+}
+
+// networks calls fn for every network in the database with the offset of
+// its data record. In IPv6 databases the IPv4 space found at ::/96 is
+// reported as IPv4, and its aliases (::ffff:0:0/96, 2002::/16) are skipped.
+func (r *mmdbReader) networks(fn func(netip.Prefix, uint32) error) error {
+	bits := 32
+	if r.ipVersion == 6 {
+		bits = 128
+	}
+
+	// Find the node the IPv4 space starts at, so that aliases pointing to
+	// it are only walked once
+	ipv4Start := uint32(0)
+	if bits == 128 {
+		for i := 0; i < 96 && ipv4Start < r.nodeCount; i++ {
+			next, err := r.record(ipv4Start, 0)
+			if err != nil {
+				return err
+			}
+			ipv4Start = next
+		}
+	}
+
+	// Apart from the IPv4 aliases every node is reached once, so a corrupt
+	// tree sharing nodes cannot make the walk take exponential time
+	visited := uint32(0)
+	var walk func(node uint32, addr [16]byte, depth int) error
+	walk = func(node uint32, addr [16]byte, depth int) error {
+		if bits == 128 && node == ipv4Start && (depth != 96 || [12]byte(addr[:12]) != [12]byte{}) {
+			return nil
+		}
+		visited++
+		if visited > r.nodeCount {
+			return fmt.Errorf("search tree reaches node %d more than once", node)
+		}
+		for bit := 0; bit < 2; bit++ {
+			next := addr
+			if bit == 1 {
+				next[depth/8] |= 0x80 >> (depth % 8)
+			}
+			value, err := r.record(node, bit)
+			if err != nil {
+				return err
+			}
+
+			switch {
+			case value < r.nodeCount:
+				if depth+1 >= bits {
+					return fmt.Errorf("search tree deeper than %d bits", bits)
+				}
+				if err := walk(value, next, depth+1); err != nil {
+					return err
+				}
+			case value == r.nodeCount:
+				// No data for this network
+			default:
+				offset := value - r.nodeCount - 16
+				if err := fn(mmdbPrefix(next, depth+1, bits), offset); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	}
+
+	var root [16]byte
+	return walk(0, root, 0)
+}
+
+func mmdbPrefix(addr [16]byte, length, bits int) netip.Prefix {
+	if bits == 32 {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(addr[:4])), length)
+	}
+	a := netip.AddrFrom16(addr)
+	if length >= 96 && [12]byte(addr[:12]) == [12]byte{} {
+		return netip.PrefixFrom(netip.AddrFrom4([4]byte(addr[12:])), length-96)
+	}
+	return netip.PrefixFrom(a, length)
+}
+
+// decode returns the value of the data record at offset.
+func (r *mmdbReader) decode(offset uint32) (any, error) {
+	value, _, err := (&mmdbDecoder{buf: r.data}).decode(int(offset))
+	return value, err
+}
+
+// mmdbDecoder decodes values of the MaxMind DB data section format.
+type mmdbDecoder struct {
+	buf    []byte
+	depth  int // nesting of the value being decoded
+	values int // values decoded so far
+}
+
+// Limits on a single decoded record. Pointers in a corrupt file can lead
+// back into the structure holding them, which would otherwise recurse
+// until the stack overflows or fan out exponentially.
+const (
+	mmdbMaxDepth  = 64
+	mmdbMaxValues = 1 << 16
+)
+
+// MaxMind DB data types.
+const (
+	mmdbExtended = iota
+	mmdbPointer
+	mmdbString
+	mmdbDouble
+	mmdbBytes
+	mmdbUint16
+	mmdbUint32
+	mmdbMap
+	mmdbInt32
+	mmdbUint64
+	mmdbUint128
+	mmdbArray
+	mmdbContainer
+	mmdbEndMarker
+	mmdbBool
+	mmdbFloat
+)
+
+// decode decodes the value at offset and returns it along with the offset
+// following it.
+func (d *mmdbDecoder) decode(offset int) (any, int, error) {
+	if offset < 0 || offset >= len(d.buf) {
+		return nil, 0, fmt.Errorf("offset %d out of range", offset)
+	}
+	d.values++
+	if d.values > mmdbMaxValues {
+		return nil, 0, fmt.Errorf("record has more than %d values", mmdbMaxValues)
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	if d.depth > mmdbMaxDepth {
+		return nil, 0, fmt.Errorf("record nested deeper than %d levels", mmdbMaxDepth)
+	}
+
+	ctrl := d.buf[offset]
+	offset++
+
+	typ := int(ctrl >> 5)
+	if typ == mmdbPointer {
+		target, next, err := d.pointer(ctrl, offset)
+		if err != nil {
+			return nil, 0, err
+		}
+		// The format does not allow a pointer to point to a pointer
+		if target < len(d.buf) && int(d.buf[target]>>5) == mmdbPointer {
+			return nil, 0, fmt.Errorf("pointer at %d points to a pointer", offset-1)
+		}
+		value, _, err := d.decode(target)
+		return value, next, err
+	}
+	if typ == mmdbExtended {
+		if offset >= len(d.buf) {
+			return nil, 0, fmt.Errorf("truncated extended type")
+		}
+		typ = int(d.buf[offset]) + 7
+		offset++
+	}
+
+	size, offset, err := d.size(ctrl, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	// Every map entry and array element takes at least one byte, so larger
+	// sizes are corrupt and must not be allocated for
+	if (typ == mmdbMap || typ == mmdbArray) && size > len(d.buf)-offset {
+		return nil, 0, fmt.Errorf("container at %d exceeds data section", offset)
+	}
+
+	switch typ {
+	case mmdbMap:
+		m := make(map[string]any, size)
+		for i := 0; i < size; i++ {
+			key, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			k, ok := key.(string)
+			if !ok {
+				return nil, 0, fmt.Errorf("map key is not a string")
+			}
+			value, next, err := d.decode(next)
+			if err != nil {
+				return nil, 0, err
+			}
+			m[k] = value
+			offset = next
+		}
+		return m, offset, nil
+	case mmdbArray:
+		a := make([]any, 0, size)
+		for i := 0; i < size; i++ {
+			value, next, err := d.decode(offset)
+			if err != nil {
+				return nil, 0, err
+			}
+			a = append(a, value)
+			offset = next
+		}
+		return a, offset, nil
+	case mmdbBool:
+		return size != 0, offset, nil
+	case mmdbEndMarker, mmdbContainer:
+		return nil, offset, nil
+	}
+
+	if offset+size > len(d.buf) {
+		return nil, 0, fmt.Errorf("value at %d exceeds data section", offset)
+	}
+	b := d.buf[offset : offset+size]
+	offset += size
+
+	switch typ {
+	case mmdbString:
+		return string(b), offset, nil
+	case mmdbBytes, mmdbUint128:
+		return append([]byte(nil), b...), offset, nil
+	case mmdbDouble:
+		if size != 8 {
+			return nil, 0, fmt.Errorf("invalid double size %d", size)
+		}
+		return math.Float64frombits(binary.BigEndian.Uint64(b)), offset, nil
+	case mmdbFloat:
+		if size != 4 {
+			return nil, 0, fmt.Errorf("invalid float size %d", size)
+		}
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(b))), offset, nil
+	case mmdbUint16, mmdbUint32, mmdbUint64:
+		var n uint64
+		for _, c := range b {
+			n = n<<8 | uint64(c)
+		}
+		return n, offset, nil
+	case mmdbInt32:
+		var n uint32
+		for _, c := range b {
+			n = n<<8 | uint32(c)
+		}
+		return int64(int32(n)), offset, nil
+	default:
+		return nil, 0, fmt.Errorf("unknown data type %d", typ)
+	}
+}
+
+// size decodes the payload size encoded in a control byte and the bytes
+// following it.
+func (d *mmdbDecoder) size(ctrl byte, offset int) (int, int, error) {
+	size := int(ctrl & 0x1f)
+	if size < 29 {
+		return size, offset, nil
+	}
+
+	n := size - 28
+	if offset+n > len(d.buf) {
+		return 0, 0, fmt.Errorf("truncated size")
+	}
+	var v int
+	for _, c := range d.buf[offset : offset+n] {
+		v = v<<8 | int(c)
+	}
+	switch n {
+	case 1:
+		size = 29 + v
+	case 2:
+		size = 285 + v
+	default:
+		size = 65821 + v
+	}
+	return size, offset + n, nil
+}
+
+// pointer decodes a pointer and returns its target offset along with the
+// offset following it.
+func (d *mmdbDecoder) pointer(ctrl byte, offset int) (int, int, error) {
+	n := int(ctrl>>3&0x3) + 1
+	if offset+n > len(d.buf) {
+		return 0, 0, fmt.Errorf("truncated pointer")
+	}
+	b := d.buf[offset : offset+n]
+
+	var v int
+	if n < 4 {
+		v = int(ctrl & 0x7)
+	}
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	switch n {
+	case 2:
+		v += 2048
+	case 3:
+		v += 526336
+	}
+	return v, offset + n, nil
+}
@@ -0,0 +1,554 @@
+package generator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mk-addrlist-generator/pkg/config"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// Parser extracts addresses from the contents of a URL or file source.
+type Parser interface {
+	Parse(r io.Reader, source string) (ParseResult, error)
+}
+
+// newParser returns the parser configured for a source.
+func newParser(cfg config.Parser) (Parser, error) {
+	switch cfg.Format {
+	case "", config.FormatAuto:
+		return autoParser{cfg: cfg}, nil
+	case config.FormatPlain:
+		return plainParser{score: cfg.ScoreColumn, minScore: cfg.MinScore}, nil
+	case config.FormatCSV:
+		return csvParser{
+			column:   max(cfg.Column, 1),
+			score:    cfg.ScoreColumn,
+			minScore: cfg.MinScore,
+			comment:  cfg.CommentColumn,
+		}, nil
+	case config.FormatJSON:
+		selector, err := parseSelector(cfg.Selector)
+		if err != nil {
+			return nil, err
+		}
+		objects := cfg.ScoreField != "" || cfg.CommentField != ""
+		if objects && (len(selector) == 0 || selector[len(selector)-1].field == "") {
+			return nil, fmt.Errorf("scoreField and commentField need a selector ending in a field name")
+		}
+		return jsonParser{
+			selector:     selector,
+			scoreField:   cfg.ScoreField,
+			minScore:     cfg.MinScore,
+			commentField: cfg.CommentField,
+		}, nil
+	case config.FormatSpamhausDrop:
+		return spamhausParser{}, nil
+	case config.FormatIPsum:
+		return ipsumParser{minScore: max(float64(cfg.Threshold), cfg.MinScore)}, nil
+	default:
+		return nil, fmt.Errorf("unknown format %s", cfg.Format)
+	}
+}
+
+// parseSource parses the contents of a source with its configured parser.
+func parseSource(r io.Reader, source string, cfg config.Parser) (ParseResult, error) {
+	parser, err := newParser(cfg)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	return parser.Parse(r, source)
+}
+
+// plainParser reads one address per line. Everything after "#" is a
+// comment. This also covers FireHOL netsets. With a score column, lines
+// are split on whitespace and the address is the first field.
+type plainParser struct {
+	score    int // 1-based, 0 if lines carry no score
+	minScore float64
+}
+
+func (p plainParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	if p.score == 0 {
+		return readAddresses(r, source)
+	}
+
+	var result ParseResult
+	err := scanLines(r, func(lineNo int, line string) {
+		var comment string
+		if before, after, ok := strings.Cut(line, "#"); ok {
+			line, comment = strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			return
+		}
+		if p.score > len(fields) {
+			result.Invalid = append(result.Invalid, &LineError{
+				Source: source,
+				Line:   lineNo,
+				Text:   line,
+				Err:    fmt.Errorf("missing score column %d", p.score),
+			})
+			return
+		}
+		prefixes := result.addScored(source, lineNo, fields[0], fields[p.score-1], p.minScore)
+		result.annotate(prefixes, Metadata{Comment: comment})
+	})
+	return result, err
+}
+
+// spamhausParser reads the Spamhaus DROP/EDROP format, where ";" starts
+// a comment ("1.10.16.0/20 ; SBL256894"). The SBL reference is kept as
+// the comment of the address.
+type spamhausParser struct{}
+
+func (spamhausParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	var result ParseResult
+	err := scanLines(r, func(lineNo int, line string) {
+		var comment string
+		if before, after, ok := strings.Cut(line, ";"); ok {
+			line, comment = strings.TrimSpace(before), strings.TrimSpace(after)
+		}
+		if line != "" {
+			result.annotate(result.add(source, lineNo, line), Metadata{Comment: comment})
+		}
+	})
+	return result, err
+}
+
+// ipsumParser reads the stamparm/ipsum format of an address followed by
+// the number of blocklists it appears on, which is used as its score.
+// Addresses below the minimum score are left out; lines without a count,
+// as in the ipsum level files, are always kept.
+type ipsumParser struct {
+	minScore float64
+}
+
+func (p ipsumParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	var result ParseResult
+	err := scanLines(r, func(lineNo int, line string) {
+		if strings.HasPrefix(line, "#") {
+			return
+		}
+		fields := strings.Fields(line)
+		switch len(fields) {
+		case 0:
+		case 1:
+			result.add(source, lineNo, fields[0])
+		default:
+			result.addScored(source, lineNo, fields[0], fields[1], p.minScore)
+		}
+	})
+	return result, err
+}
+
+// csvParser reads the address from a column of a CSV file, and its score
+// and comment from other ones if configured. A first row that does not hold an
+// address is treated as a header.
+type csvParser struct {
+	column   int // 1-based
+	score    int // 1-based, 0 if rows carry no score
+	minScore float64
+	comment  int // 1-based, 0 if rows carry no comment
+}
+
+func (p csvParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	var result ParseResult
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	reader.ReuseRecord = true
+
+	for row := 1; ; row++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return ParseResult{}, err
+		}
+		line, _ := reader.FieldPos(0)
+
+		if p.column > len(record) {
+			result.Invalid = append(result.Invalid, &LineError{
+				Source: source,
+				Line:   line,
+				Text:   strings.Join(record, ","),
+				Err:    fmt.Errorf("missing column %d", p.column),
+			})
+			continue
+		}
+		text := strings.TrimSpace(record[p.column-1])
+		if row == 1 {
+			if _, err := ParseAddress(text); err != nil {
+				continue
+			}
+		}
+		var meta Metadata
+		if p.comment > 0 && p.comment <= len(record) {
+			meta.Comment = strings.TrimSpace(record[p.comment-1])
+		}
+
+		if p.score == 0 {
+			result.annotate(result.add(source, line, text), meta)
+			continue
+		}
+		if p.score > len(record) {
+			result.Invalid = append(result.Invalid, &LineError{
+				Source: source,
+				Line:   line,
+				Text:   strings.Join(record, ","),
+				Err:    fmt.Errorf("missing score column %d", p.score),
+			})
+			continue
+		}
+		result.annotate(result.addScored(source, line, text, record[p.score-1], p.minScore), meta)
+	}
+
+	return result, nil
+}
+
+// jsonParser reads addresses from JSON documents. Several documents may
+// follow each other, as in newline-delimited JSON. With a score or
+// comment field, the selector ends in the address field and the score and
+// comment are read from the same object.
+type jsonParser struct {
+	selector     []selectorStep
+	scoreField   string
+	minScore     float64
+	commentField string
+}
+
+func (p jsonParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	var result ParseResult
+
+	decoder := json.NewDecoder(r)
+	decoder.UseNumber()
+	for doc := 1; ; doc++ {
+		var value any
+		if err := decoder.Decode(&value); err == io.EOF {
+			break
+		} else if err != nil {
+			return ParseResult{}, fmt.Errorf("invalid JSON: %v", err)
+		}
+
+		if p.selector == nil {
+			// Without a selector every string holding an address is used
+			walkStrings(value, func(s string) {
+				if parsed, err := ParseAddress(strings.TrimSpace(s)); err == nil {
+					result.Prefixes = append(result.Prefixes, parsed.Prefixes...)
+				}
+			})
+			continue
+		}
+
+		if p.scoreField != "" || p.commentField != "" {
+			p.parseObjects(value, source, doc, &result)
+			continue
+		}
+
+		for _, v := range selectValues(value, p.selector) {
+			s, ok := v.(string)
+			if !ok {
+				result.Invalid = append(result.Invalid, &LineError{
+					Source: source,
+					Line:   doc,
+					Text:   fmt.Sprint(v),
+					Err:    fmt.Errorf("selected value is not a string"),
+				})
+				continue
+			}
+			result.add(source, doc, strings.TrimSpace(s))
+		}
+	}
+
+	return result, nil
+}
+
+// parseObjects reads the address, score and comment fields of every
+// object picked by the selector without its last step.
+func (p jsonParser) parseObjects(value any, source string, doc int, result *ParseResult) {
+	parents := p.selector[:len(p.selector)-1]
+	field := p.selector[len(p.selector)-1].field
+
+	for _, v := range selectValues(value, parents) {
+		object, ok := v.(map[string]any)
+		if !ok {
+			continue
+		}
+		addr, ok := object[field].(string)
+		if !ok {
+			continue
+		}
+		addr = strings.TrimSpace(addr)
+
+		var meta Metadata
+		if comment, ok := object[p.commentField]; ok && p.commentField != "" {
+			meta.Comment = fmt.Sprint(comment)
+		}
+
+		if p.scoreField == "" {
+			result.annotate(result.add(source, doc, addr), meta)
+			continue
+		}
+		score, ok := object[p.scoreField]
+		if !ok {
+			result.Invalid = append(result.Invalid, &LineError{
+				Source: source,
+				Line:   doc,
+				Text:   addr,
+				Err:    fmt.Errorf("missing score field %s", p.scoreField),
+			})
+			continue
+		}
+		result.annotate(result.addScored(source, doc, addr, fmt.Sprint(score), p.minScore), meta)
+	}
+}
+
+func walkStrings(value any, fn func(string)) {
+	switch v := value.(type) {
+	case string:
+		fn(v)
+	case []any:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	case map[string]any:
+		for _, item := range v {
+			walkStrings(item, fn)
+		}
+	}
+}
+
+// selectorStep is one step of a JSON selector: a field name, an array
+// index, or a wildcard over all array items or object values.
+type selectorStep struct {
+	field    string
+	index    int
+	isIndex  bool
+	wildcard bool
+}
+
+// parseSelector parses a JSONPath-like selector such as
+// "$.data[*].ipAddress", "items[0].cidr" or "*.prefix".
+func parseSelector(s string) ([]selectorStep, error) {
+	if s == "" {
+		return nil, nil
+	}
+	rest := strings.TrimPrefix(strings.TrimPrefix(s, "$"), ".")
+
+	steps := []selectorStep{}
+	for rest != "" {
+		switch {
+		case rest[0] == '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid selector %q: missing ]", s)
+			}
+			inner := strings.Trim(rest[1:end], `'"`)
+			switch n, err := strconv.Atoi(inner); {
+			case inner == "*":
+				steps = append(steps, selectorStep{wildcard: true})
+			case err == nil:
+				steps = append(steps, selectorStep{index: n, isIndex: true})
+			case inner != "":
+				steps = append(steps, selectorStep{field: inner})
+			default:
+				return nil, fmt.Errorf("invalid selector %q: empty brackets", s)
+			}
+			rest = rest[end+1:]
+		case rest[0] == '.':
+			rest = rest[1:]
+			if rest == "" || rest[0] == '.' {
+				return nil, fmt.Errorf("invalid selector %q: empty field", s)
+			}
+		default:
+			end := strings.IndexAny(rest, ".[")
+			if end < 0 {
+				end = len(rest)
+			}
+			field := rest[:end]
+			if field == "*" {
+				steps = append(steps, selectorStep{wildcard: true})
+			} else {
+				steps = append(steps, selectorStep{field: field})
+			}
+			rest = rest[end:]
+		}
+	}
+	return steps, nil
+}
+
+// selectValues returns the values matched by selector in value. Arrays
+// reached at the end of the selector are expanded into their items.
+func selectValues(value any, selector []selectorStep) []any {
+	if len(selector) == 0 {
+		if items, ok := value.([]any); ok {
+			return items
+		}
+		return []any{value}
+	}
+
+	step, rest := selector[0], selector[1:]
+	var matches []any
+	switch v := value.(type) {
+	case []any:
+		switch {
+		case step.wildcard:
+			for _, item := range v {
+				matches = append(matches, selectValues(item, rest)...)
+			}
+		case step.isIndex && step.index >= 0 && step.index < len(v):
+			matches = selectValues(v[step.index], rest)
+		}
+	case map[string]any:
+		switch {
+		case step.wildcard:
+			for _, item := range v {
+				matches = append(matches, selectValues(item, rest)...)
+			}
+		case !step.isIndex:
+			if item, ok := v[step.field]; ok {
+				matches = selectValues(item, rest)
+			}
+		}
+	}
+	return matches
+}
+
+// autoParser detects the format of a source from its contents.
+type autoParser struct {
+	cfg config.Parser
+}
+
+func (p autoParser) Parse(r io.Reader, source string) (ParseResult, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ParseResult{}, err
+	}
+
+	cfg := p.cfg
+	cfg.Format = detectFormat(data)
+	parser, err := newParser(cfg)
+	if err != nil {
+		return ParseResult{}, err
+	}
+	return parser.Parse(bytes.NewReader(data), source)
+}
+
+// detectFormat guesses the format of a source from its first lines.
+func detectFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return config.FormatJSON
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for checked := 0; scanner.Scan() && checked < 20; {
+		line := strings.TrimSpace(scanner.Text())
+		if idx := strings.Index(line, "#"); idx != -1 {
+			line = strings.TrimSpace(line[:idx])
+		}
+		if line == "" {
+			continue
+		}
+		checked++
+
+		if strings.HasPrefix(line, ";") || strings.Contains(line, " ; ") {
+			return config.FormatSpamhausDrop
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 2 {
+			if _, err := strconv.Atoi(fields[1]); err == nil {
+				return config.FormatIPsum
+			}
+		}
+		if strings.Contains(line, ",") {
+			return config.FormatCSV
+		}
+	}
+	return config.FormatPlain
+}
+
+// scanLines calls fn for every non-empty, trimmed line of r.
+func scanLines(r io.Reader, fn func(lineNo int, line string)) error {
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			fn(lineNo, line)
+		}
+	}
+	return scanner.Err()
+}
+
+// add parses text as an address and records it, or records the line as
+// invalid.
+func (r *ParseResult) add(source string, line int, text string) []netip.Prefix {
+	parsed, err := ParseAddress(text)
+	if err != nil {
+		r.Invalid = append(r.Invalid, &LineError{
+			Source: source,
+			Line:   line,
+			Text:   text,
+			Err:    err,
+		})
+		return nil
+	}
+	r.Prefixes = append(r.Prefixes, parsed.Prefixes...)
+	return parsed.Prefixes
+}
+
+// addScored records an address scored by the source. Addresses scored
+// below minScore are left out. It returns the prefixes recorded.
+func (r *ParseResult) addScored(source string, line int, text, scoreText string, minScore float64) []netip.Prefix {
+	score, err := strconv.ParseFloat(strings.TrimSpace(scoreText), 64)
+	if err != nil {
+		r.Invalid = append(r.Invalid, &LineError{
+			Source: source,
+			Line:   line,
+			Text:   text,
+			Err:    fmt.Errorf("invalid score: %q", scoreText),
+		})
+		return nil
+	}
+	if score < minScore {
+		return nil
+	}
+
+	prefixes := r.add(source, line, text)
+	r.annotate(prefixes, Metadata{Score: score, Scored: true})
+	return prefixes
+}
+
+// annotate merges meta into the metadata of prefixes. A prefix listed
+// several times keeps its highest score and its first comment and timeout.
+func (r *ParseResult) annotate(prefixes []netip.Prefix, meta Metadata) {
+	if meta == (Metadata{}) {
+		return
+	}
+	if r.Metadata == nil {
+		r.Metadata = make(map[netip.Prefix]Metadata)
+	}
+	for _, prefix := range prefixes {
+		current := r.Metadata[prefix]
+		if meta.Scored && (!current.Scored || meta.Score > current.Score) {
+			current.Score, current.Scored = meta.Score, true
+		}
+		if current.Comment == "" {
+			current.Comment = meta.Comment
+		}
+		if meta.HasTimeout && !current.HasTimeout {
+			current.Timeout, current.HasTimeout = meta.Timeout, true
+		}
+		r.Metadata[prefix] = current
+	}
+}
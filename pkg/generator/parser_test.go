@@ -0,0 +1,316 @@
+package generator
+
+import (
+	"mk-addrlist-generator/pkg/config"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseSource(t *testing.T) {
+	tests := []struct {
+		name        string
+		parser      config.Parser
+		input       string
+		want        []string
+		wantInvalid int
+		wantErr     bool
+	}{
+		{
+			name:   "plain",
+			parser: config.Parser{Format: config.FormatPlain},
+			input:  "# FireHOL netset\n192.168.1.1\n10.0.0.0/8 # private\n",
+			want:   []string{"192.168.1.1/32", "10.0.0.0/8"},
+		},
+		{
+			name:   "spamhaus drop",
+			parser: config.Parser{Format: config.FormatSpamhausDrop},
+			input:  "; Spamhaus DROP List\n1.10.16.0/20 ; SBL256894\n1.19.0.0/16 ; SBL434604\n",
+			want:   []string{"1.10.16.0/20", "1.19.0.0/16"},
+		},
+		{
+			name:   "ipsum with threshold",
+			parser: config.Parser{Format: config.FormatIPsum, Threshold: 3},
+			input:  "# IPsum Threat Intelligence Feed\n192.0.2.1\t8\n192.0.2.2\t3\n192.0.2.3\t2\n",
+			want:   []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:        "ipsum invalid count",
+			parser:      config.Parser{Format: config.FormatIPsum},
+			input:       "192.0.2.1\tmany\n192.0.2.2\t1\n",
+			want:        []string{"192.0.2.2/32"},
+			wantInvalid: 1,
+		},
+		{
+			name:   "csv with header and column",
+			parser: config.Parser{Format: config.FormatCSV, Column: 2},
+			input:  "id,ip,reason\n1,192.0.2.1,scanner\n2,\"2001:db8::1\",\"brute, force\"\n",
+			want:   []string{"192.0.2.1/32", "2001:db8::1/128"},
+		},
+		{
+			name:        "csv missing column",
+			parser:      config.Parser{Format: config.FormatCSV, Column: 3},
+			input:       "192.0.2.1,a,192.0.2.9\n192.0.2.2\n",
+			want:        []string{"192.0.2.9/32"},
+			wantInvalid: 1,
+		},
+		{
+			name:   "json with selector",
+			parser: config.Parser{Format: config.FormatJSON, Selector: "$.data[*].ipAddress"},
+			input:  `{"meta":{"generatedAt":"2024-01-01"},"data":[{"ipAddress":"192.0.2.1","abuseConfidenceScore":100},{"ipAddress":"192.0.2.2"}]}`,
+			want:   []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:        "json selector on non-string",
+			parser:      config.Parser{Format: config.FormatJSON, Selector: "items[*].score"},
+			input:       `{"items":[{"score":1}]}`,
+			wantInvalid: 1,
+		},
+		{
+			name:   "newline delimited json",
+			parser: config.Parser{Format: config.FormatJSON, Selector: "cidr"},
+			input:  "{\"cidr\":\"1.10.16.0/20\",\"sblid\":\"SBL256894\"}\n{\"cidr\":\"1.19.0.0/16\",\"sblid\":\"SBL434604\"}\n",
+			want:   []string{"1.10.16.0/20", "1.19.0.0/16"},
+		},
+		{
+			name:    "invalid json",
+			parser:  config.Parser{Format: config.FormatJSON},
+			input:   `{"data": [`,
+			wantErr: true,
+		},
+		{
+			name:    "invalid selector",
+			parser:  config.Parser{Format: config.FormatJSON, Selector: "data[*"},
+			input:   `{}`,
+			wantErr: true,
+		},
+		{
+			name:   "auto json without selector",
+			parser: config.Parser{},
+			input:  `["192.0.2.1", {"note": "not an address", "ip": "192.0.2.2"}]`,
+			want:   []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:   "auto spamhaus drop",
+			parser: config.Parser{Format: config.FormatAuto},
+			input:  "; Last-Modified: Tue, 1 Jan 2024\n1.10.16.0/20 ; SBL256894\n",
+			want:   []string{"1.10.16.0/20"},
+		},
+		{
+			name:   "auto ipsum uses threshold",
+			parser: config.Parser{Threshold: 5},
+			input:  "# IPsum\n192.0.2.1\t8\n192.0.2.2\t1\n",
+			want:   []string{"192.0.2.1/32"},
+		},
+		{
+			name:   "auto csv",
+			parser: config.Parser{},
+			input:  "192.0.2.1,scanner\n192.0.2.2,spam\n",
+			want:   []string{"192.0.2.1/32", "192.0.2.2/32"},
+		},
+		{
+			name:   "auto plain with comma in comment",
+			parser: config.Parser{},
+			input:  "192.0.2.1 # scanner, seen twice\n",
+			want:   []string{"192.0.2.1/32"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSource(strings.NewReader(tt.input), "test", tt.parser)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSource() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if !stringSliceEqual(prefixStrings(got.Prefixes), tt.want) {
+				t.Errorf("parseSource() = %v, want %v", prefixStrings(got.Prefixes), tt.want)
+			}
+			if len(got.Invalid) != tt.wantInvalid {
+				t.Errorf("parseSource() invalid = %v, want %d", got.Invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	tests := []struct {
+		selector string
+		want     int
+		wantErr  bool
+	}{
+		{selector: "", want: 0},
+		{selector: "$.data[*].ipAddress", want: 3},
+		{selector: "items[0]['cidr']", want: 3},
+		{selector: "*.prefix", want: 2},
+		{selector: "data[*", wantErr: true},
+		{selector: "data..ip", wantErr: true},
+		{selector: "data[]", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.selector, func(t *testing.T) {
+			got, err := parseSelector(tt.selector)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseSelector() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if len(got) != tt.want {
+				t.Errorf("parseSelector() = %+v, want %d steps", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSource_Scores(t *testing.T) {
+	tests := []struct {
+		name        string
+		parser      config.Parser
+		input       string
+		want        map[string]float64 // prefix -> score
+		wantInvalid int
+	}{
+		{
+			name:   "ipsum min score",
+			parser: config.Parser{Format: config.FormatIPsum, MinScore: 3},
+			input:  "192.0.2.1\t7\n192.0.2.2\t2\n192.0.2.3\n",
+			want:   map[string]float64{"192.0.2.1/32": 7, "192.0.2.3/32": -1},
+		},
+		{
+			name:        "plain score column",
+			parser:      config.Parser{Format: config.FormatPlain, ScoreColumn: 3, MinScore: 50},
+			input:       "192.0.2.1 scanner 80\n192.0.2.2 spam 10\n192.0.2.3 spam\n192.0.2.4 spam high\n",
+			want:        map[string]float64{"192.0.2.1/32": 80},
+			wantInvalid: 2,
+		},
+		{
+			name:   "csv score column keeps highest score",
+			parser: config.Parser{Format: config.FormatCSV, ScoreColumn: 2, MinScore: 0.5},
+			input:  "ip,confidence\n192.0.2.1,0.75\n192.0.2.1,0.9\n192.0.2.2,0.25\n",
+			want:   map[string]float64{"192.0.2.1/32": 0.9},
+		},
+		{
+			name:        "json score field",
+			parser:      config.Parser{Format: config.FormatJSON, Selector: "$.data[*].ipAddress", ScoreField: "abuseConfidenceScore", MinScore: 90},
+			input:       `{"data":[{"ipAddress":"192.0.2.1","abuseConfidenceScore":100},{"ipAddress":"192.0.2.2","abuseConfidenceScore":40},{"ipAddress":"192.0.2.3"}]}`,
+			want:        map[string]float64{"192.0.2.1/32": 100},
+			wantInvalid: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSource(strings.NewReader(tt.input), "test", tt.parser)
+			if err != nil {
+				t.Fatalf("parseSource() error = %v", err)
+			}
+
+			prefixes := make(map[string]bool)
+			for _, p := range got.Prefixes {
+				prefixes[p.String()] = true
+			}
+			if len(prefixes) != len(tt.want) {
+				t.Errorf("parseSource() = %v, want %v", prefixStrings(got.Prefixes), tt.want)
+			}
+			for _, p := range got.Prefixes {
+				score, ok := tt.want[p.String()]
+				if !ok {
+					t.Errorf("parseSource() unexpected prefix %s", p)
+					continue
+				}
+				meta := got.Metadata[p]
+				if score < 0 {
+					if meta.Scored {
+						t.Errorf("parseSource() %s scored %v, want no score", p, meta.Score)
+					}
+				} else if !meta.Scored || meta.Score != score {
+					t.Errorf("parseSource() %s score = %+v, want %v", p, meta, score)
+				}
+			}
+			if len(got.Invalid) != tt.wantInvalid {
+				t.Errorf("parseSource() invalid = %v, want %d", got.Invalid, tt.wantInvalid)
+			}
+		})
+	}
+}
+
+func TestGenerator_GenerateListScores(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ipsum.txt")
+	if err := os.WriteFile(path, []byte("192.0.2.1\t7\n192.0.2.2\t1\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {
+				Files: []config.FileSource{{Path: path, Parser: config.Parser{Format: config.FormatIPsum, MinScore: 3}}},
+			},
+		},
+	}
+
+	script, err := NewGenerator(cfg).GenerateList("test", cfg.Lists["test"])
+	if err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+	if want := `$testAddIP "192.0.2.1" "test/file/score=7" "1d"`; !strings.Contains(script, want) {
+		t.Errorf("GenerateList() script does not contain expected line: %s", want)
+	}
+	if strings.Contains(script, "192.0.2.2") {
+		t.Errorf("GenerateList() script contains address below minScore")
+	}
+}
+
+func TestParseSource_Comments(t *testing.T) {
+	tests := []struct {
+		name   string
+		parser config.Parser
+		input  string
+		want   map[string]string // prefix -> comment
+	}{
+		{
+			name:   "plain inline comment and trailing fields",
+			parser: config.Parser{Format: config.FormatPlain},
+			input:  "192.0.2.1 # scanner\n192.0.2.2 brute force # ssh\n192.0.2.3\n",
+			want:   map[string]string{"192.0.2.1/32": "scanner", "192.0.2.2/32": "brute force ssh", "192.0.2.3/32": ""},
+		},
+		{
+			name:   "spamhaus reference",
+			parser: config.Parser{Format: config.FormatSpamhausDrop},
+			input:  "1.10.16.0/20 ; SBL256894\n",
+			want:   map[string]string{"1.10.16.0/20": "SBL256894"},
+		},
+		{
+			name:   "csv comment column",
+			parser: config.Parser{Format: config.FormatCSV, CommentColumn: 2},
+			input:  "192.0.2.1,\"scanner, ssh\"\n192.0.2.2\n",
+			want:   map[string]string{"192.0.2.1/32": "scanner, ssh", "192.0.2.2/32": ""},
+		},
+		{
+			name:   "json comment field",
+			parser: config.Parser{Format: config.FormatJSON, Selector: "[*].cidr", CommentField: "sblid"},
+			input:  `[{"cidr":"1.10.16.0/20","sblid":"SBL256894"},{"cidr":"1.19.0.0/16"}]`,
+			want:   map[string]string{"1.10.16.0/20": "SBL256894", "1.19.0.0/16": ""},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseSource(strings.NewReader(tt.input), "test", tt.parser)
+			if err != nil {
+				t.Fatalf("parseSource() error = %v", err)
+			}
+			if len(got.Prefixes) != len(tt.want) || len(got.Invalid) != 0 {
+				t.Fatalf("parseSource() = %v, invalid %v, want %v", prefixStrings(got.Prefixes), got.Invalid, tt.want)
+			}
+			for _, p := range got.Prefixes {
+				if comment := got.Metadata[p].Comment; comment != tt.want[p.String()] {
+					t.Errorf("parseSource() %s comment = %q, want %q", p, comment, tt.want[p.String()])
+				}
+			}
+		})
+	}
+}
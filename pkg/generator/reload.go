@@ -0,0 +1,70 @@
+package generator
+
+import (
+	"mk-addrlist-generator/pkg/config"
+	"slices"
+)
+
+// Reload switches the generator to cfg. Cached sources, DNS answers and
+// list versions are kept, so feeds are not downloaded again and routers
+// keep receiving diffs. The resolver and the ASN and GeoIP tables are only
+// replaced when their settings change, HTTP clients are recreated so that
+// renewed certificates are picked up, and background refreshing is
+// restarted for the new set of sources. Lists being generated finish with
+// the previous configuration first.
+func (g *Generator) Reload(cfg *config.Config) {
+	g.lifecycle.Lock()
+	defer g.lifecycle.Unlock()
+
+	g.mu.Lock()
+	old := g.cfg
+	oldCache, oldResolver, oldASNs, oldCountries := g.cache, g.resolver, g.asns, g.countries
+	g.cfg = cfg
+
+	if cfg.Config.CacheDir != old.Config.CacheDir {
+		g.cache = newSourceCache(g.fetchDocument, cfg.Config.CacheDir)
+	}
+	// Certificates and CA bundles may have been replaced on disk
+	g.clients.reset()
+	if cfg.Config.Resolver != old.Config.Resolver {
+		g.resolver = newCachingResolver(newDNSResolver(cfg.Config.Resolver))
+	}
+	if cfg.Config.ASNData != old.Config.ASNData {
+		g.asns = newASNTable(cfg.Config.ASNData.File)
+	}
+	if !sameGeoData(cfg.Config.GeoData, old.Config.GeoData) {
+		g.countries = newCountryTable(cfg.Config.GeoData.Files, cfg.Config.GeoData.Locations)
+	}
+	cache, resolver, asns, countries := g.cache, g.resolver, g.asns, g.countries
+	sources := g.refreshedSources()
+	domains := g.refreshedDomains()
+	g.mu.Unlock()
+
+	// Refreshers are restarted without holding mu, so that lists can be
+	// generated while their fetches and lookups are being cancelled
+	if g.running {
+		oldCache.stop()
+		cache.start(sources)
+		oldResolver.stop()
+		resolver.start(domains)
+	}
+
+	// Replaced tables stop reloading; new ones start if running
+	var newASNs *prefixTable[uint32]
+	if asns != oldASNs {
+		oldASNs.stop()
+		newASNs = asns
+	}
+	var newCountries *prefixTable[string]
+	if countries != oldCountries {
+		oldCountries.stop()
+		newCountries = countries
+	}
+	if g.running {
+		startTables(cfg, newASNs, newCountries)
+	}
+}
+
+func sameGeoData(a, b config.GeoData) bool {
+	return slices.Equal(a.Files, b.Files) && a.Locations == b.Locations && a.Refresh == b.Refresh
+}
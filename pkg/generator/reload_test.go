@@ -0,0 +1,105 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGenerator_ReloadDuringSlowRefresh(t *testing.T) {
+	var slow atomic.Bool
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if slow.Load() {
+			select {
+			case <-release:
+			case <-r.Context().Done():
+			}
+			return
+		}
+		fmt.Fprintln(w, "192.168.1.1")
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", Refresh: "1h"},
+		Lists: map[string]config.List{
+			"test": {URLs: []config.URLSource{{URL: srv.URL}}},
+		},
+	}
+	g := NewGenerator(cfg)
+	if _, err := g.GenerateList("test", cfg.Lists["test"]); err != nil {
+		t.Fatalf("GenerateList() error = %v", err)
+	}
+
+	// The background refresh started here hangs on the upstream
+	slow.Store(true)
+	g.Start()
+	defer g.Stop()
+	time.Sleep(50 * time.Millisecond)
+
+	reloaded := make(chan struct{})
+	go func() {
+		g.Reload(cfg)
+		close(reloaded)
+	}()
+
+	generated := make(chan error, 1)
+	go func() {
+		_, err := g.GenerateList("test", cfg.Lists["test"])
+		generated <- err
+	}()
+	select {
+	case err := <-generated:
+		if err != nil {
+			t.Fatalf("GenerateList() error = %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("GenerateList() waited for the refresh in progress")
+	}
+
+	select {
+	case <-reloaded:
+	case <-time.After(time.Second):
+		t.Fatal("Reload() did not cancel the refresh in progress")
+	}
+}
+
+func TestGenerator_GenerateNamedListReport(t *testing.T) {
+	cfg := &config.Config{
+		Config: config.ConfigDefaults{Timeout: "1d", CommentPrefix: "test"},
+		Lists: map[string]config.List{
+			"test": {Addresses: []config.AddressGroup{{Addresses: []string{"192.0.2.1"}}}},
+		},
+	}
+	g := NewGenerator(cfg)
+
+	if _, err := g.GenerateNamedListReport("other", Options{}); !errors.Is(err, ErrUnknownList) {
+		t.Errorf("GenerateNamedListReport() error = %v, want ErrUnknownList", err)
+	}
+
+	// The list is taken from the configuration the generator switched to
+	g.Reload(&config.Config{
+		Config: cfg.Config,
+		Lists: map[string]config.List{
+			"other": {Addresses: []config.AddressGroup{{Addresses: []string{"198.51.100.1"}}}},
+		},
+	})
+	report, err := g.GenerateNamedListReport("other", Options{})
+	if err != nil {
+		t.Fatalf("GenerateNamedListReport() error = %v", err)
+	}
+	if !strings.Contains(report.Script, `$otherAddIP "198.51.100.1"`) {
+		t.Errorf("GenerateNamedListReport() script does not contain the reloaded list:\n%s", report.Script)
+	}
+	if _, err := g.GenerateNamedListReport("test", Options{}); !errors.Is(err, ErrUnknownList) {
+		t.Errorf("GenerateNamedListReport() error = %v, want ErrUnknownList for a removed list", err)
+	}
+}
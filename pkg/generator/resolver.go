@@ -0,0 +1,364 @@
+package generator
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// defaultResolverTimeout bounds a single DNS query.
+const defaultResolverTimeout = 5 * time.Second
+
+// ResolvedAddr is an address returned for a domain along with the TTL of
+// the record it came from.
+type ResolvedAddr struct {
+	Addr netip.Addr
+	TTL  time.Duration
+}
+
+// Resolver looks up the A and AAAA records of a domain.
+type Resolver interface {
+	Resolve(ctx context.Context, domain string) ([]ResolvedAddr, error)
+}
+
+// staticResolver answers from a fixed table. It is meant for tests.
+type staticResolver map[string][]ResolvedAddr
+
+func (r staticResolver) Resolve(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+	addrs, ok := r[strings.TrimSuffix(domain, ".")]
+	if !ok {
+		return nil, fmt.Errorf("no such host: %s", domain)
+	}
+	return addrs, nil
+}
+
+// dnsResolver queries a single DNS server directly so that record TTLs,
+// which the standard library resolver hides, are available.
+type dnsResolver struct {
+	server  string
+	timeout time.Duration
+}
+
+// newDNSResolver returns a resolver for server ("host" or "host:port").
+// An empty server uses the first nameserver of /etc/resolv.conf.
+func newDNSResolver(server string) *dnsResolver {
+	if server == "" {
+		server = systemNameserver()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		server = net.JoinHostPort(server, "53")
+	}
+	return &dnsResolver{server: server, timeout: defaultResolverTimeout}
+}
+
+func systemNameserver() string {
+	file, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
+
+func (r *dnsResolver) Resolve(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+	var addrs []ResolvedAddr
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		answers, err := r.query(ctx, domain, qtype)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, answers...)
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("no A or AAAA records for %s", domain)
+	}
+	return addrs, nil
+}
+
+func (r *dnsResolver) query(ctx context.Context, domain string, qtype dnsmessage.Type) ([]ResolvedAddr, error) {
+	name, err := dnsmessage.NewName(dnsName(domain))
+	if err != nil {
+		return nil, fmt.Errorf("invalid domain %q: %v", domain, err)
+	}
+
+	id := uint16(rand.UintN(1 << 16))
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	packed, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+
+	resp, err := r.exchange(ctx, "udp", packed)
+	if err != nil {
+		return nil, err
+	}
+	var msg dnsmessage.Message
+	if err := msg.Unpack(resp); err != nil {
+		return nil, err
+	}
+	// Truncated answers are retried over TCP
+	if msg.Truncated {
+		if resp, err = r.exchange(ctx, "tcp", packed); err != nil {
+			return nil, err
+		}
+		if err := msg.Unpack(resp); err != nil {
+			return nil, err
+		}
+	}
+
+	if msg.ID != id {
+		return nil, fmt.Errorf("mismatched DNS response id for %s", domain)
+	}
+	if msg.RCode != dnsmessage.RCodeSuccess {
+		return nil, fmt.Errorf("DNS lookup of %s failed: %v", domain, msg.RCode)
+	}
+
+	var addrs []ResolvedAddr
+	for _, answer := range msg.Answers {
+		ttl := time.Duration(answer.Header.TTL) * time.Second
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, ResolvedAddr{Addr: netip.AddrFrom4(body.A), TTL: ttl})
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, ResolvedAddr{Addr: netip.AddrFrom16(body.AAAA).Unmap(), TTL: ttl})
+		}
+	}
+	return addrs, nil
+}
+
+// exchange sends a packed query and returns the raw response. TCP messages
+// carry a two-byte length prefix.
+func (r *dnsResolver) exchange(ctx context.Context, network string, packed []byte) ([]byte, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, r.server)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if network == "tcp" {
+		msg := make([]byte, 2+len(packed))
+		binary.BigEndian.PutUint16(msg, uint16(len(packed)))
+		copy(msg[2:], packed)
+		if _, err := conn.Write(msg); err != nil {
+			return nil, err
+		}
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, err
+		}
+		resp := make([]byte, binary.BigEndian.Uint16(length[:]))
+		if _, err := io.ReadFull(conn, resp); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	if _, err := conn.Write(packed); err != nil {
+		return nil, err
+	}
+	resp := make([]byte, 65535)
+	n, err := conn.Read(resp)
+	if err != nil {
+		return nil, err
+	}
+	return resp[:n], nil
+}
+
+func dnsName(domain string) string {
+	if strings.HasSuffix(domain, ".") {
+		return domain
+	}
+	return domain + "."
+}
+
+// minResolveInterval is the shortest time between background lookups of
+// a domain, so that names with very short or zero TTLs are not queried
+// continuously. Failed lookups are retried after the same interval.
+const minResolveInterval = 30 * time.Second
+
+// cachingResolver keeps answers until their shortest TTL expires, so lists
+// are regenerated without querying DNS for every request. Domains passed to
+// start are resolved again in the background whenever their answer
+// expires, and lists are served their last good answer meanwhile.
+type cachingResolver struct {
+	resolver Resolver
+
+	mu        sync.Mutex
+	answers   map[string]cachedAnswer
+	refreshed map[string]bool // domains resolved in the background
+	ctx       context.Context // cancelled by stop
+
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+type cachedAnswer struct {
+	addrs    []ResolvedAddr
+	resolved time.Time
+	expires  time.Time
+}
+
+func newCachingResolver(resolver Resolver) *cachingResolver {
+	return &cachingResolver{
+		resolver:  resolver,
+		answers:   make(map[string]cachedAnswer),
+		refreshed: make(map[string]bool),
+	}
+}
+
+// stale returns the last answer for domain, even if it has expired.
+func (r *cachingResolver) stale(domain string) ([]ResolvedAddr, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	answer, ok := r.answers[domain]
+	return answer.addrs, ok
+}
+
+// lookup resolves domain for list generation. Queries that cannot be
+// answered from memory are cancelled when the resolver is stopped.
+func (r *cachingResolver) lookup(domain string) ([]ResolvedAddr, error) {
+	r.mu.Lock()
+	ctx := r.ctx
+	r.mu.Unlock()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return r.Resolve(ctx, domain)
+}
+
+// Resolve returns the cached answer for domain with the TTL remaining since
+// it was resolved. Domains resolved in the background are served their last
+// answer even once it expired, reporting its original TTL; other domains
+// are resolved again when their answer expires.
+func (r *cachingResolver) Resolve(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+	r.mu.Lock()
+	answer, ok := r.answers[domain]
+	refreshed := r.refreshed[domain]
+	r.mu.Unlock()
+
+	now := time.Now()
+	switch {
+	case ok && now.Before(answer.expires):
+		elapsed := now.Sub(answer.resolved)
+		addrs := make([]ResolvedAddr, len(answer.addrs))
+		for i, a := range answer.addrs {
+			addrs[i] = ResolvedAddr{Addr: a.Addr, TTL: max(a.TTL-elapsed, 0)}
+		}
+		return addrs, nil
+	case ok && refreshed:
+		return answer.addrs, nil
+	}
+
+	addrs, _, err := r.refresh(ctx, domain)
+	return addrs, err
+}
+
+// refresh queries domain and caches the answer, returning it along with its
+// shortest TTL.
+func (r *cachingResolver) refresh(ctx context.Context, domain string) ([]ResolvedAddr, time.Duration, error) {
+	addrs, err := r.resolver.Resolve(ctx, domain)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	ttl := time.Duration(-1)
+	for _, a := range addrs {
+		if ttl < 0 || a.TTL < ttl {
+			ttl = a.TTL
+		}
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	r.answers[domain] = cachedAnswer{addrs: addrs, resolved: now, expires: now.Add(ttl)}
+	r.mu.Unlock()
+
+	return addrs, ttl, nil
+}
+
+// start launches a background lookup goroutine for every domain. Each
+// domain is resolved immediately and then again when its answer expires.
+func (r *cachingResolver) start(domains []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.mu.Lock()
+	r.ctx = ctx
+	r.refreshed = make(map[string]bool, len(domains))
+	for _, domain := range domains {
+		r.refreshed[domain] = true
+	}
+	r.mu.Unlock()
+
+	for _, domain := range domains {
+		r.wg.Add(1)
+		go r.refreshLoop(ctx, domain)
+	}
+}
+
+func (r *cachingResolver) refreshLoop(ctx context.Context, domain string) {
+	defer r.wg.Done()
+
+	for {
+		_, ttl, err := r.refresh(ctx, domain)
+		if err != nil && ctx.Err() == nil {
+			log.Printf("Error resolving %s, serving last answer: %v", domain, err)
+		}
+
+		timer := time.NewTimer(max(ttl, minResolveInterval))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+	}
+}
+
+// stop terminates all background lookups, cancelling queries in progress.
+func (r *cachingResolver) stop() {
+	if r.cancel == nil {
+		return
+	}
+	r.cancel()
+	r.wg.Wait()
+	r.cancel = nil
+
+	r.mu.Lock()
+	r.ctx = nil
+	r.refreshed = make(map[string]bool)
+	r.mu.Unlock()
+}
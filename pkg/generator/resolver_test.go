@@ -0,0 +1,253 @@
+package generator
+
+import (
+	"context"
+	"fmt"
+	"mk-addrlist-generator/pkg/config"
+	"net"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// startStubDNS serves A/AAAA answers from records on a local UDP port.
+func startStubDNS(t *testing.T, records map[string][]netip.Addr, ttl uint32) string {
+	t.Helper()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ListenPacket() error = %v", err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			var query dnsmessage.Message
+			if err := query.Unpack(buf[:n]); err != nil || len(query.Questions) != 1 {
+				continue
+			}
+			q := query.Questions[0]
+			resp := dnsmessage.Message{
+				Header:    dnsmessage.Header{ID: query.ID, Response: true},
+				Questions: query.Questions,
+			}
+
+			addrs, ok := records[strings.TrimSuffix(q.Name.String(), ".")]
+			if !ok {
+				resp.RCode = dnsmessage.RCodeNameError
+			}
+			for _, a := range addrs {
+				hdr := dnsmessage.ResourceHeader{Name: q.Name, Class: dnsmessage.ClassINET, TTL: ttl}
+				switch {
+				case a.Is4() && q.Type == dnsmessage.TypeA:
+					hdr.Type = dnsmessage.TypeA
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: a.As4()}})
+				case a.Is6() && q.Type == dnsmessage.TypeAAAA:
+					hdr.Type = dnsmessage.TypeAAAA
+					resp.Answers = append(resp.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: a.As16()}})
+				}
+			}
+
+			packed, err := resp.Pack()
+			if err != nil {
+				continue
+			}
+			conn.WriteTo(packed, addr)
+		}
+	}()
+
+	return conn.LocalAddr().String()
+}
+
+func TestDNSResolver_Resolve(t *testing.T) {
+	server := startStubDNS(t, map[string][]netip.Addr{
+		"example.com": {
+			netip.MustParseAddr("192.0.2.10"),
+			netip.MustParseAddr("2001:db8::10"),
+		},
+	}, 300)
+
+	r := newDNSResolver(server)
+
+	addrs, err := r.Resolve(context.Background(), "example.com")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	if len(addrs) != 2 {
+		t.Fatalf("Resolve() = %v, want 2 addresses", addrs)
+	}
+	if addrs[0].Addr.String() != "192.0.2.10" || addrs[1].Addr.String() != "2001:db8::10" {
+		t.Errorf("Resolve() = %v, unexpected addresses", addrs)
+	}
+	if addrs[0].TTL != 300*time.Second {
+		t.Errorf("Resolve() TTL = %v, want %v", addrs[0].TTL, 300*time.Second)
+	}
+
+	if _, err := r.Resolve(context.Background(), "missing.example.com"); err == nil {
+		t.Errorf("Resolve() expected error for unknown domain")
+	}
+}
+
+func TestGenerator_GenerateListDomains(t *testing.T) {
+	resolver := staticResolver{
+		"api.example.com": {
+			{Addr: netip.MustParseAddr("192.0.2.10"), TTL: 90 * time.Second},
+			{Addr: netip.MustParseAddr("2001:db8::10"), TTL: 90 * time.Second},
+		},
+	}
+
+	tests := []struct {
+		name       string
+		ttlTimeout bool
+		want       []string
+	}{
+		{
+			name: "list timeout",
+			want: []string{
+				`$testAddIP "192.0.2.10" "test/dns/api.example.com" "1d"`,
+				`$testAddIPv6 "2001:db8::10" "test/dns/api.example.com" "1d"`,
+			},
+		},
+		{
+			name:       "ttl timeout",
+			ttlTimeout: true,
+			want: []string{
+				`$testAddIP "192.0.2.10" "test/dns/api.example.com" "00:01:30"`,
+				`$testAddIPv6 "2001:db8::10" "test/dns/api.example.com" "00:01:30"`,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := &config.Config{
+				Config: config.ConfigDefaults{
+					Timeout:       "1d",
+					CommentPrefix: "test",
+				},
+				Lists: map[string]config.List{
+					"test": {
+						Domains:    []string{"api.example.com"},
+						TTLTimeout: tt.ttlTimeout,
+					},
+				},
+			}
+
+			g := NewGenerator(cfg)
+			g.resolver = newCachingResolver(resolver)
+
+			script, err := g.GenerateList("test", cfg.Lists["test"])
+			if err != nil {
+				t.Fatalf("GenerateList() error = %v", err)
+			}
+			for _, line := range tt.want {
+				if !strings.Contains(script, line) {
+					t.Errorf("GenerateList() script does not contain expected line: %s", line)
+				}
+			}
+		})
+	}
+}
+
+func TestCachingResolver_Stale(t *testing.T) {
+	resolver := staticResolver{
+		"api.example.com": {{Addr: netip.MustParseAddr("192.0.2.10")}},
+	}
+	r := newCachingResolver(resolver)
+
+	if _, err := r.Resolve(context.Background(), "api.example.com"); err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	delete(resolver, "api.example.com")
+
+	if _, err := r.Resolve(context.Background(), "api.example.com"); err == nil {
+		t.Errorf("Resolve() expected error once the zero TTL answer expired")
+	}
+	if addrs, ok := r.stale("api.example.com"); !ok || len(addrs) != 1 {
+		t.Errorf("stale() = %v, %v, want last answer", addrs, ok)
+	}
+}
+
+// resolverFunc adapts a function to the Resolver interface.
+type resolverFunc func(ctx context.Context, domain string) ([]ResolvedAddr, error)
+
+func (f resolverFunc) Resolve(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+	return f(ctx, domain)
+}
+
+func TestCachingResolver_BackgroundRefresh(t *testing.T) {
+	var queries atomic.Int32
+	var failing atomic.Bool
+	r := newCachingResolver(resolverFunc(func(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+		queries.Add(1)
+		if failing.Load() {
+			return nil, fmt.Errorf("server failure")
+		}
+		return []ResolvedAddr{{Addr: netip.MustParseAddr("192.0.2.10")}}, nil
+	}))
+	r.start([]string{"api.example.com"})
+	defer r.stop()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for _, ok := r.stale("api.example.com"); !ok && time.Now().Before(deadline); _, ok = r.stale("api.example.com") {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// The zero TTL answer has expired, but lists are served it without
+	// querying the server until the next background lookup
+	failing.Store(true)
+	queried := queries.Load()
+	addrs, err := r.lookup("api.example.com")
+	if err != nil {
+		t.Fatalf("lookup() error = %v", err)
+	}
+	if len(addrs) != 1 || addrs[0].Addr.String() != "192.0.2.10" {
+		t.Errorf("lookup() = %v, want last answer", addrs)
+	}
+	if got := queries.Load(); got != queried {
+		t.Errorf("lookup() queried the server %d times, want 0", got-queried)
+	}
+}
+
+func TestCachingResolver_StopCancelsLookups(t *testing.T) {
+	r := newCachingResolver(resolverFunc(func(ctx context.Context, domain string) ([]ResolvedAddr, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}))
+	r.start([]string{"slow.example.com"})
+
+	done := make(chan error, 1)
+	go func() {
+		_, err := r.lookup("slow.example.com")
+		done <- err
+	}()
+	time.Sleep(20 * time.Millisecond)
+
+	stopped := make(chan struct{})
+	go func() {
+		r.stop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("stop() waited for the lookup in progress")
+	}
+	select {
+	case err := <-done:
+		if err == nil {
+			t.Error("lookup() expected error once the resolver stopped")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("lookup() was not cancelled by stop()")
+	}
+}
@@ -0,0 +1,38 @@
+package generator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// escapeString escapes s for use inside a double-quoted RouterOS string.
+// Quotes, backslashes, variable references and command substitutions are
+// taken literally, and control characters are written as escape sequences
+// so that a value can never end the string or the command it appears in.
+func escapeString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '$', '?':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case '\n':
+			b.WriteString(`\n`)
+		case '\r':
+			b.WriteString(`\r`)
+		case '\t':
+			b.WriteString(`\t`)
+		case ';', '[', ']', '{', '}':
+			// Written as hex escapes so that line-based tools and older
+			// RouterOS parsers never see a statement or block delimiter
+			fmt.Fprintf(&b, `\%02X`, r)
+		default:
+			if r < 0x20 || r == 0x7f {
+				fmt.Fprintf(&b, `\%02X`, r)
+				continue
+			}
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
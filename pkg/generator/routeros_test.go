@@ -0,0 +1,28 @@
+package generator
+
+import "testing"
+
+func TestEscapeString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{input: "plain comment", want: "plain comment"},
+		{input: `say "hi"`, want: `say \"hi\"`},
+		{input: `C:\path`, want: `C:\\path`},
+		{input: "$var", want: `\$var`},
+		{input: "what?", want: `what\?`},
+		{input: "a;b", want: `a\3Bb`},
+		{input: "[/system reboot]", want: `\5B/system reboot\5D`},
+		{input: "{x}", want: `\7Bx\7D`},
+		{input: "line\nbreak\ttab\r", want: `line\nbreak\ttab\r`},
+		{input: "bell\x07", want: `bell\07`},
+		{input: "naïve", want: "naïve"},
+	}
+
+	for _, tt := range tests {
+		if got := escapeString(tt.input); got != tt.want {
+			t.Errorf("escapeString(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
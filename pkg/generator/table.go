@@ -0,0 +1,133 @@
+package generator
+
+import (
+	"fmt"
+	"log"
+	"net/netip"
+	"os"
+	"sync"
+	"time"
+)
+
+// prefixTable maps keys such as AS numbers or country codes to prefixes.
+// It is loaded from local data files and reloaded when any of them
+// changes; on failure the previously loaded table is kept.
+type prefixTable[K comparable] struct {
+	name  string
+	paths []string
+	read  func(paths []string) (map[K][]netip.Prefix, error)
+
+	mu       sync.Mutex
+	loaded   bool
+	modTimes []time.Time
+	prefixes map[K][]netip.Prefix
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+func newPrefixTable[K comparable](name string, paths []string, read func([]string) (map[K][]netip.Prefix, error)) *prefixTable[K] {
+	return &prefixTable[K]{name: name, paths: paths, read: read}
+}
+
+// lookup returns the prefixes stored for key, loading the data files the
+// first time they are needed.
+func (t *prefixTable[K]) lookup(key K) ([]netip.Prefix, error) {
+	t.mu.Lock()
+	loaded := t.loaded
+	t.mu.Unlock()
+
+	if !loaded {
+		if err := t.reload(); err != nil {
+			return nil, err
+		}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.prefixes[key], nil
+}
+
+// reload reads the data files again if any of them changed since the last
+// load.
+func (t *prefixTable[K]) reload() error {
+	if len(t.paths) == 0 {
+		return fmt.Errorf("no %s file configured", t.name)
+	}
+
+	modTimes := make([]time.Time, len(t.paths))
+	for i, path := range t.paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	t.mu.Lock()
+	unchanged := t.loaded && timesEqual(modTimes, t.modTimes)
+	t.mu.Unlock()
+	if unchanged {
+		return nil
+	}
+
+	prefixes, err := t.read(t.paths)
+	if err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	t.prefixes = prefixes
+	t.modTimes = modTimes
+	t.loaded = true
+	t.mu.Unlock()
+	return nil
+}
+
+// start reloads the data files every interval until stop is called.
+func (t *prefixTable[K]) start(interval time.Duration) {
+	if interval <= 0 || len(t.paths) == 0 {
+		return
+	}
+	t.done = make(chan struct{})
+	t.wg.Add(1)
+	go func() {
+		defer t.wg.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if err := t.reload(); err != nil {
+				log.Printf("Error reloading %s, keeping previous table: %v", t.name, err)
+			}
+
+			select {
+			case <-t.done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+func (t *prefixTable[K]) stop() {
+	if t.done == nil {
+		return
+	}
+	close(t.done)
+	t.wg.Wait()
+	t.done = nil
+}
+
+func timesEqual(a, b []time.Time) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if !a[i].Equal(b[i]) {
+			return false
+		}
+	}
+	return true
+}